@@ -9,6 +9,7 @@ package argon2
 
 /*
 #include <stdint.h>
+#include <stdlib.h>
 
 #include "argon2.h"
 #include "core.h"
@@ -22,10 +23,13 @@ typedef struct bindings_argon2_config {
 	uint32_t Parallelism;
 	uint32_t Mode;
 	uint32_t Version;
+	uint32_t MaxPasswordLength;
+	uint8_t SingleThreaded;
+	uint8_t AllowArgon2dForPasswords;
 } bindings_argon2_config;
 
 // A simplified version of argon2_hash()
-int bindings_argon2_hash(const bindings_argon2_config* cfg, void* pwd, const uint32_t pwdlen, void* salt, const uint32_t saltlen, void* hash, const uint32_t hashlen) {
+int bindings_argon2_hash(const bindings_argon2_config* cfg, void* pwd, const uint32_t pwdlen, void* salt, const uint32_t saltlen, void* secret, const uint32_t secretlen, void* ad, const uint32_t adlen, void* hash, const uint32_t hashlen) {
 	argon2_context c = {
 		.out = hash,
 		.outlen = hashlen,
@@ -33,14 +37,14 @@ int bindings_argon2_hash(const bindings_argon2_config* cfg, void* pwd, const uin
 		.pwdlen = pwdlen,
 		.salt = salt,
 		.saltlen = saltlen,
-		.secret = NULL,
-		.secretlen = 0,
-		.ad = NULL,
-		.adlen = 0,
+		.secret = secret,
+		.secretlen = secretlen,
+		.ad = ad,
+		.adlen = adlen,
 		.t_cost = cfg->TimeCost,
 		.m_cost = cfg->MemoryCost,
 		.lanes = cfg->Parallelism,
-		.threads = cfg->Parallelism,
+		.threads = cfg->SingleThreaded ? 1 : cfg->Parallelism,
 		.version = cfg->Version,
 		.allocate_cbk = NULL,
 		.free_cbk = NULL,
@@ -55,11 +59,50 @@ int bindings_argon2_hash(const bindings_argon2_config* cfg, void* pwd, const uin
 
 	return rc;
 }
+
+// Works like bindings_argon2_hash(), but compares the hash against `expected`
+// in constant time and stores the result in `match`, instead of returning it.
+int bindings_argon2_verify(const bindings_argon2_config* cfg, void* pwd, const uint32_t pwdlen, void* salt, const uint32_t saltlen, void* secret, const uint32_t secretlen, void* ad, const uint32_t adlen, const void* expected, const uint32_t hashlen, int* match) {
+	uint8_t* hash = malloc(hashlen);
+	if (hash == NULL) {
+		return ARGON2_MEMORY_ALLOCATION_ERROR;
+	}
+
+	const int rc = bindings_argon2_hash(cfg, pwd, pwdlen, salt, saltlen, secret, secretlen, ad, adlen, hash, hashlen);
+
+	if (rc == ARGON2_OK) {
+		const uint8_t* e = expected;
+		uint8_t diff = 0;
+
+		for (uint32_t i = 0; i < hashlen; i++) {
+			diff |= hash[i] ^ e[i];
+		}
+
+		*match = diff == 0;
+	}
+
+	secure_wipe_memory(hash, hashlen);
+	free(hash);
+	return rc;
+}
 */
 import "C"
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 	"unsafe"
 )
 
@@ -101,6 +144,11 @@ func (m Mode) String() string {
 	}
 }
 
+// SupportedModes returns all Mode constants supported by this package.
+func SupportedModes() []Mode {
+	return []Mode{ModeArgon2d, ModeArgon2i, ModeArgon2id}
+}
+
 // Version exists for type check purposes. See Config.
 type Version uint32
 
@@ -125,6 +173,14 @@ func (v Version) String() string {
 	}
 }
 
+// SupportedVersions returns all Version constants supported by this package.
+func SupportedVersions() []Version {
+	return []Version{Version10, Version13}
+}
+
+// MaxMemory is the maximum Config.MemoryCost supported by argon2 on this platform.
+const MaxMemory = uint32(C.ARGON2_MAX_MEMORY)
+
 // NOTE: Keep `Config` in sync with the C code at the beginning of this file.
 
 // Config contains all configuration parameters for the Argon2 hash function.
@@ -138,7 +194,8 @@ func (v Version) String() string {
 type Config struct {
 	// HashLength specifies the length of the resulting hash in Bytes.
 	//
-	// Must be > 0.
+	// Must be >= 4. Argon2 supports arbitrarily long outputs up to the
+	// limits of uint32, which can be used to derive long keys.
 	HashLength uint32
 
 	// SaltLength specifies the length of the resulting salt in Bytes,
@@ -161,7 +218,8 @@ type Config struct {
 
 	// Parallelism specifies the amount of threads to use.
 	//
-	// Must be > 0.
+	// A value of 0 is treated as 1, which is then also
+	// recorded in the Config of the resulting Raw.
 	Parallelism uint32
 
 	// Mode specifies the hashing method used by argon2.
@@ -172,13 +230,67 @@ type Config struct {
 
 	// Version specifies the argon2 version to be used.
 	Version Version
+
+	// MaxPasswordLength limits the length of passwords in Bytes, which are
+	// otherwise rejected with ErrPwdTooLong. This prevents untrusted clients
+	// from wasting resources with abusively long passwords.
+	// Servers typically cap passwords at 128 or 1024 bytes.
+	//
+	// A value of 0 means unlimited.
+	MaxPasswordLength uint32
+
+	// SingleThreaded makes argon2 process all Parallelism lanes sequentially
+	// on the calling OS thread instead of spawning one native thread per lane.
+	//
+	// The resulting hash is identical either way, since the lanes are part
+	// of the algorithm, while threads are only an implementation detail.
+	// This is useful if you'd rather parallelize across passwords using
+	// goroutines, as each hash then occupies only a single OS thread.
+	// Note that cgo calls are not bounded by GOMAXPROCS, so it's up to you
+	// to limit the number of concurrent hashes, e.g. using a Pool.
+	SingleThreaded bool
+
+	// AllowArgon2dForPasswords permits HashEncoded() to use ModeArgon2d,
+	// which is otherwise rejected with ErrUnsafeModeForPasswords, since it's
+	// vulnerable to side-channel attacks. Hash() and DeriveKey() are unaffected.
+	AllowArgon2dForPasswords bool
 }
 
+// Config is passed to C by pointer, which is why this
+// fails to compile if its size differs from the C struct.
+var _ = [1]struct{}{}[unsafe.Sizeof(Config{})-C.sizeof_bindings_argon2_config]
+
+// DefaultMode is the Mode used by DefaultConfig().
+//
+// It's ModeArgon2i for backwards compatibility, but ModeArgon2id is the
+// current best practice and will become the default in the next major version.
+// Set it to ModeArgon2id during initialization to opt in early.
+var DefaultMode = ModeArgon2i
+
 // DefaultConfig returns a Config struct suitable for most servers.
 //
 // These default settings result in around 7ms of computation time while using 4 MiB of memory.
 // (Tested on an i7 3770 @ 3.4 GHz & G.Skill F3-14900CL9D @ 1886 MHz).
 func DefaultConfig() Config {
+	return Config{
+		HashLength:  32,
+		SaltLength:  16,
+		TimeCost:    3,
+		MemoryCost:  1 << 12,
+		Parallelism: 1,
+		Mode:        DefaultMode,
+		Version:     Version13,
+	}
+}
+
+// BenchmarkConfig returns a fixed Config meant solely for benchmarks,
+// which allows comparing results across machines and over time.
+// Unlike DefaultConfig() it never changes, not even with DefaultMode:
+//
+//	$argon2i$v=19$m=4096,t=3,p=1 with a 16 byte salt and a 32 byte hash
+//
+// Use DefaultConfig() for actual password hashing.
+func BenchmarkConfig() Config {
 	return Config{
 		HashLength:  32,
 		SaltLength:  16,
@@ -190,64 +302,698 @@ func DefaultConfig() Config {
 	}
 }
 
+// MemoryPerLane returns the total Config.MemoryCost for `kibPerLane` KiB of
+// memory per lane, i.e. kibPerLane * parallelism. Results exceeding MaxMemory,
+// including those overflowing a uint32, are clamped to MaxMemory instead
+// of wrapping around, so that the result remains a valid MemoryCost.
+//
+// Argon2 splits its memory into Parallelism lanes of equally many 1 KiB blocks,
+// which is why the MemoryCost is rounded down to a multiple of 4 * Parallelism
+// internally and must be at least 8 * Parallelism.
+func MemoryPerLane(kibPerLane, parallelism uint32) uint32 {
+	m := uint64(kibPerLane) * uint64(parallelism)
+	if m > uint64(MaxMemory) {
+		return MaxMemory
+	}
+	return uint32(m)
+}
+
+// DefaultConfigID identifies the parameters of DefaultConfig().
+// It changes whenever those parameters change. See RecommendedProfile().
+const DefaultConfigID = "2016-1"
+
+// Profile describes a set of parameters recommended at some point in time.
+// Storing the ID alongside a hash allows you to track under which profile
+// it was made and to decide whether to rehash it. See Config.MatchesProfile.
+type Profile struct {
+	ID          string
+	Mode        Mode
+	Version     Version
+	MemoryCost  uint32
+	TimeCost    uint32
+	Parallelism uint32
+}
+
+// RecommendedProfile returns the Profile of the current DefaultConfig(),
+// whose Mode thus follows DefaultMode.
+func RecommendedProfile() Profile {
+	c := DefaultConfig()
+	return Profile{
+		ID:          DefaultConfigID,
+		Mode:        c.Mode,
+		Version:     c.Version,
+		MemoryCost:  c.MemoryCost,
+		TimeCost:    c.TimeCost,
+		Parallelism: c.Parallelism,
+	}
+}
+
+// MatchesProfile returns true if the Config uses exactly the parameters of `p`.
+func (c *Config) MatchesProfile(p Profile) bool {
+	c = c.withDefaultParallelism()
+	return c.Mode == p.Mode &&
+		c.Version == p.Version &&
+		c.MemoryCost == p.MemoryCost &&
+		c.TimeCost == p.TimeCost &&
+		c.Parallelism == p.Parallelism
+}
+
+// CommandLine returns a shell command reproducing a hash with the Config
+// and `salt` using the argon2 command line tool of the reference implementation:
+//
+//	echo -n password | argon2 'saltsalt' -i -t 3 -m 12 -p 1 -l 32 -v 13
+//
+// The tool expects the memory cost as a power of 2 for -m. Other values are
+// passed as KiB using -k instead. Since the salt is passed as an argument,
+// only printable salts can be reproduced this way.
+func (c *Config) CommandLine(salt []byte) string {
+	c = c.withDefaultParallelism()
+
+	mode := "-i"
+	switch c.Mode {
+	case ModeArgon2d:
+		mode = "-d"
+	case ModeArgon2id:
+		mode = "-id"
+	}
+
+	mem := "-k " + strconv.FormatUint(uint64(c.MemoryCost), 10)
+	if c.MemoryCost != 0 && c.MemoryCost&(c.MemoryCost-1) == 0 {
+		mem = "-m " + strconv.Itoa(bits.TrailingZeros32(c.MemoryCost))
+	}
+
+	return "echo -n password | argon2 " +
+		"'" + strings.ReplaceAll(string(salt), "'", `'\''`) + "' " +
+		mode +
+		" -t " + strconv.FormatUint(uint64(c.TimeCost), 10) +
+		" " + mem +
+		" -p " + strconv.FormatUint(uint64(c.Parallelism), 10) +
+		" -l " + strconv.FormatUint(uint64(c.HashLength), 10) +
+		" -v " + c.Version.String()
+}
+
+// ThreatModel exists for type check purposes. See ConfigForThreat.
+type ThreatModel uint32
+
+const (
+	// ThreatSideChannelSensitive selects ModeArgon2i for environments
+	// where side-channel timing attacks are the primary concern.
+	ThreatSideChannelSensitive ThreatModel = iota
+
+	// ThreatGPUResistant selects ModeArgon2d for environments without
+	// side-channel threats, where GPU cracking attacks are the primary concern.
+	//
+	// Since HashEncoded() rejects ModeArgon2d with ErrUnsafeModeForPasswords,
+	// the resulting Config only works with Hash() and DeriveKey(), unless
+	// you explicitly set Config.AllowArgon2dForPasswords.
+	ThreatGPUResistant
+
+	// ThreatBalanced selects ModeArgon2id, which offers a compromise
+	// between the resistance against both kinds of attacks.
+	ThreatBalanced
+)
+
+// ConfigForThreat returns a variant of DefaultConfig() using the Mode for the
+// given ThreatModel. All cost parameters remain those of DefaultConfig().
+//
+// AllowArgon2dForPasswords is not set, which is why the Config for
+// ThreatGPUResistant fails with HashEncoded(). See ThreatGPUResistant.
+func ConfigForThreat(threat ThreatModel) Config {
+	c := DefaultConfig()
+
+	switch threat {
+	case ThreatGPUResistant:
+		c.Mode = ModeArgon2d
+	case ThreatBalanced:
+		c.Mode = ModeArgon2id
+	default:
+		c.Mode = ModeArgon2i
+	}
+
+	return c
+}
+
+// WithDefaults returns a copy of the Config, in which every zero-valued
+// field has been replaced with the corresponding value of DefaultConfig().
+//
+// Since ModeArgon2d is the zero value of Mode, it will be replaced as well.
+// Set the Mode after calling this method if you really need ModeArgon2d.
+func (c Config) WithDefaults() Config {
+	d := DefaultConfig()
+
+	if c.HashLength == 0 {
+		c.HashLength = d.HashLength
+	}
+	if c.SaltLength == 0 {
+		c.SaltLength = d.SaltLength
+	}
+	if c.TimeCost == 0 {
+		c.TimeCost = d.TimeCost
+	}
+	if c.MemoryCost == 0 {
+		c.MemoryCost = d.MemoryCost
+	}
+	if c.Parallelism == 0 {
+		c.Parallelism = d.Parallelism
+	}
+	if c.Mode == 0 {
+		c.Mode = d.Mode
+	}
+	if c.Version == 0 {
+		c.Version = d.Version
+	}
+
+	return c
+}
+
+// WithScaledCost returns a copy of the Config, in which TimeCost and
+// MemoryCost have been multiplied by `factor` and rounded to the nearest
+// integer. The results are clamped to the range of values argon2 supports.
+//
+// Invalid factors are clamped as well: +Inf results in the maximum costs,
+// while NaN, -Inf and factors <= 0 result in the minimum costs.
+func (c Config) WithScaledCost(factor float64) Config {
+	minMemory := 8 * float64(c.Parallelism)
+	if minMemory < C.ARGON2_MIN_MEMORY {
+		minMemory = C.ARGON2_MIN_MEMORY
+	}
+
+	c.TimeCost = uint32(clamp(math.Round(float64(c.TimeCost)*factor), C.ARGON2_MIN_TIME, C.ARGON2_MAX_TIME))
+	c.MemoryCost = uint32(clamp(math.Round(float64(c.MemoryCost)*factor), minMemory, float64(MaxMemory)))
+	return c
+}
+
+// Clamps `v` to [min, max], treating NaN as `min`.
+func clamp(v, min, max float64) float64 {
+	if math.IsNaN(v) {
+		return min
+	}
+	return math.Max(min, math.Min(max, v))
+}
+
+// AtLeastAsStrong returns true if every security relevant parameter of `b`
+// is greater than or equal to the one of `a`. This can be used to enforce
+// policies under which configurations may only ever get stronger.
+//
+// For password hashing ModeArgon2i and ModeArgon2id are considered equally
+// strong and stronger than ModeArgon2d. Similarly Version13 is stronger than Version10.
+func AtLeastAsStrong(a, b *Config) bool {
+	return b.TimeCost >= a.TimeCost &&
+		b.MemoryCost >= a.MemoryCost &&
+		b.HashLength >= a.HashLength &&
+		b.SaltLength >= a.SaltLength &&
+		b.Version >= a.Version &&
+		modeStrength(b.Mode) >= modeStrength(a.Mode)
+}
+
+// Returns the relative strength of a Mode for password hashing purposes.
+func modeStrength(m Mode) int {
+	switch m {
+	case ModeArgon2i, ModeArgon2id:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Baseline exists for type check purposes. See Config.MeetsBaseline.
+type Baseline uint32
+
+const (
+	// BaselineOWASP represents the minimum configuration recommended by the
+	// OWASP Password Storage Cheat Sheet: ModeArgon2id with Version13,
+	// at least 19456 KiB of memory and a TimeCost of at least 2.
+	BaselineOWASP Baseline = iota
+
+	// BaselineNISTMin represents the minimums of NIST SP 800-63B, which
+	// doesn't prescribe Argon2 cost parameters, but requires a salt of at least
+	// 32 bits and a hash providing at least 112 bits of security strength.
+	BaselineNISTMin
+)
+
+// MeetsBaseline returns true if the Config meets the given Baseline.
+// Otherwise it returns false and a description of each shortcoming,
+// e.g. "memory cost below 19456 KiB".
+func (c *Config) MeetsBaseline(b Baseline) (bool, []string) {
+	var failures []string
+	fail := func(cond bool, msg string) {
+		if cond {
+			failures = append(failures, msg)
+		}
+	}
+
+	switch b {
+	case BaselineOWASP:
+		fail(c.Mode != ModeArgon2id, "mode is not Argon2id")
+		fail(c.Version < Version13, "version below 13")
+		fail(c.MemoryCost < 19456, "memory cost below 19456 KiB")
+		fail(c.TimeCost < 2, "time cost below 2")
+	case BaselineNISTMin:
+		fail(c.SaltLength < 4, "salt length below 4 bytes")
+		fail(c.HashLength < 14, "hash length below 14 bytes")
+	default:
+		fail(true, "unknown baseline")
+	}
+
+	return len(failures) == 0, failures
+}
+
+// SaltReader is the source of randomness used to generate salts.
+// It defaults to crypto/rand.Reader and should only be replaced during
+// initialization, for instance to make tests deterministic.
+//
+// In builds with the "fips" build tag only crypto/rand.Reader is permitted
+// and salt generation fails with ErrCustomSaltReader if it was replaced.
+var SaltReader io.Reader = rand.Reader
+
+// GenerateSalt returns `n` random bytes read from SaltReader,
+// which defaults to crypto/rand. ErrSaltTooShort is returned if n <= 0.
+func GenerateSalt(n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, ErrSaltTooShort
+	}
+
+	if fipsMode && SaltReader != rand.Reader {
+		return nil, ErrCustomSaltReader
+	}
+
+	salt := make([]byte, n)
+	if _, err := io.ReadFull(SaltReader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// GenerateSalts works like GenerateSalt(), but returns `count` independent
+// salts of `length` bytes each, which are read from SaltReader at once.
+// ErrIncorrectParameter is returned if `count` is negative or too large.
+func GenerateSalts(count, length int) ([][]byte, error) {
+	if count < 0 || (length > 0 && count > math.MaxInt/length) {
+		return nil, ErrIncorrectParameter
+	}
+	if length <= 0 {
+		return nil, ErrSaltTooShort
+	}
+
+	salts := make([][]byte, count)
+	if count == 0 {
+		return salts, nil
+	}
+
+	buf, err := GenerateSalt(count * length)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range salts {
+		off := i * length
+		salts[i] = buf[off : off+length : off+length]
+	}
+
+	return salts, nil
+}
+
+// saltSource describes the current SaltReader. See Raw.SaltSource.
+func saltSource() string {
+	if SaltReader == rand.Reader {
+		return "crypto/rand"
+	}
+	return reflect.TypeOf(SaltReader).String()
+}
+
 // Hash takes a password and optionally a salt and returns an Argon2 hash.
 //
 // If salt is nil a appropriate salt of Config.SaltLength bytes is generated for you.
 // It is recommended to use SecureZeroMemory(pwd) afterwards.
 func (c *Config) Hash(pwd []byte, salt []byte) (*Raw, error) {
-	if pwd == nil {
-		return nil, ErrPwdTooShort
+	r, err := c.hash(pwd, salt, nil, "", nil)
+	return r, wrapOp("hash", err)
+}
+
+// HashWithSecret works like Hash(), but additionally uses the secret
+// registered under `kid` in Secrets and stores `kid` in Raw.KeyID,
+// which allows Raw.Verify() to find the secret again after a rotation.
+// An empty `kid` results in no secret being used, just like Hash().
+//
+// ErrUnknownKeyID is returned if `kid` has not been registered.
+func (c *Config) HashWithSecret(pwd []byte, salt []byte, kid string) (*Raw, error) {
+	secret, err := Secrets.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.hash(pwd, salt, nil, kid, secret)
+	return r, wrapOp("hash", err)
+}
+
+// OnHash is invoked after each call to Config.Hash() and Raw.Verify() with
+// the Config used, the duration of the operation and the resulting error.
+// It never receives the password or any derived bytes and is nil by default.
+//
+// It's meant for audit logging and should only be set during initialization.
+var OnHash func(cfg *Config, duration time.Duration, err error)
+
+// DetectConfigMutation makes Hash() record a copy of the Config in the
+// resulting Raw. Raw.Verify() then returns ErrConfigMutated if Raw.Config
+// has been modified since, instead of silently computing a different hash.
+//
+// It's disabled by default to avoid the additional allocation
+// and should only be set during initialization.
+var DetectConfigMutation bool
+
+// hash works like Hash(), but additionally accepts associated data `ad`,
+// which is stored in Raw.Data, as well as the `secret` identified by `kid`.
+func (c *Config) hash(pwd []byte, salt []byte, ad []byte, kid string, secret []byte) (r *Raw, err error) {
+	c = c.withDefaultParallelism()
+
+	if OnHash != nil {
+		start := time.Now()
+		defer func() { OnHash(c, time.Since(start), err) }()
 	}
 
+	source := ""
+
 	if salt == nil {
-		salt = make([]byte, c.SaltLength)
-		_, err := rand.Read(salt)
+		var err error
+		salt, err = GenerateSalt(int(c.SaltLength))
 
 		if err != nil {
 			return nil, err
 		}
+
+		source = saltSource()
+	}
+
+	hash := make([]byte, c.HashLength)
+
+	if err := c.hashTo(hash, pwd, salt, ad, secret); err != nil {
+		return nil, err
+	}
+
+	r = &Raw{
+		Config:     *c,
+		Salt:       salt,
+		Hash:       hash,
+		Data:       ad,
+		KeyID:      kid,
+		SaltSource: source,
 	}
 
-	pwdptr := unsafe.Pointer(nil)
-	pwdlen := C.uint32_t(len(pwd))
-	saltptr := unsafe.Pointer(nil)
-	saltlen := C.uint32_t(len(salt))
-	hashptr := unsafe.Pointer(nil)
-	hashlen := C.uint32_t(c.HashLength)
+	if DetectConfigMutation {
+		orig := *c
+		r.origConfig = &orig
+	}
 
-	hash := make([]byte, hashlen)
+	return r, nil
+}
 
-	if pwdlen > 0 {
-		pwdptr = unsafe.Pointer(&pwd[0])
+// HashTo works like DeriveKey(), but writes len(dst) bytes of output directly
+// into `dst`, ignoring Config.HashLength. This avoids any allocations.
+// `dst` is wiped if an error occurs.
+func (c *Config) HashTo(dst []byte, pwd []byte, salt []byte) error {
+	if salt == nil {
+		salt = []byte{}
 	}
 
-	if saltlen > 0 {
-		saltptr = unsafe.Pointer(&salt[0])
+	err := c.hashTo(dst, pwd, salt, nil, nil)
+	if err != nil {
+		wipe(dst)
 	}
+	return wrapOp("hash", err)
+}
 
-	if hashlen > 0 {
-		hashptr = unsafe.Pointer(&hash[0])
+// hashTo calls into argon2, which writes its output directly into `hash`.
+func (c *Config) hashTo(hash []byte, pwd []byte, salt []byte, ad []byte, secret []byte) error {
+	if err := c.checkInputs(len(hash), pwd, salt, ad, secret); err != nil {
+		return err
 	}
 
+	c = c.withDefaultParallelism()
+
+	pwdptr, pwdlen := cbytes(pwd)
+	saltptr, saltlen := cbytes(salt)
+	secretptr, secretlen := cbytes(secret)
+	adptr, adlen := cbytes(ad)
+	hashptr, hashlen := cbytes(hash)
+
 	rc := C.bindings_argon2_hash(
 		(*C.struct_bindings_argon2_config)(unsafe.Pointer(c)),
 		pwdptr,
 		pwdlen,
 		saltptr,
 		saltlen,
+		secretptr,
+		secretlen,
+		adptr,
+		adlen,
 		hashptr,
 		hashlen,
 	)
 
 	if rc != C.ARGON2_OK {
-		return nil, Error(rc)
+		return Error(rc)
 	}
 
-	return &Raw{
-		Config: *c,
-		Salt:   salt,
-		Hash:   hash,
-	}, nil
+	return nil
+}
+
+// checkInputs catches invalid inputs for an output of `outlen` bytes before calling into argon2.
+func (c *Config) checkInputs(outlen int, pwd []byte, salt []byte, ad []byte, secret []byte) error {
+	if pwd == nil {
+		return ErrPwdTooShort
+	}
+	if c.MaxPasswordLength != 0 && uint64(len(pwd)) > uint64(c.MaxPasswordLength) {
+		return ErrPwdTooLong
+	}
+
+	// All lengths are passed to argon2 as uint32_t and must not overflow.
+	if uint64(outlen) > C.ARGON2_MAX_OUTLEN {
+		return ErrOutputTooLong
+	}
+	if uint64(len(pwd)) > C.ARGON2_MAX_PWD_LENGTH {
+		return ErrPwdTooLong
+	}
+	if uint64(len(secret)) > C.ARGON2_MAX_SECRET {
+		return ErrSecretTooLong
+	}
+	if uint64(len(ad)) > C.ARGON2_MAX_AD_LENGTH {
+		return ErrAdTooLong
+	}
+
+	return c.validate(salt)
+}
+
+// cbytes returns a pointer to the first element of `b` and its length,
+// or nil if `b` is empty. The length must have been checked for overflows.
+func cbytes(b []byte) (unsafe.Pointer, C.uint32_t) {
+	if len(b) == 0 {
+		return nil, 0
+	}
+	return unsafe.Pointer(&b[0]), C.uint32_t(len(b))
+}
+
+// HashShared hashes each of `pwds` using the same `salt` and `cfg`.
+// If `salt` is nil a single salt is generated and shared by all hashes.
+//
+// WARNING: This is NOT recommended and only exists for legacy schemes.
+// Sharing a salt allows attackers to crack all of the hashes at once and
+// reveals which of them belong to identical passwords. Use Hash() instead.
+func HashShared(salt []byte, cfg *Config, pwds ...[]byte) ([]*Raw, error) {
+	if salt == nil {
+		var err error
+		salt, err = GenerateSalt(int(cfg.SaltLength))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	raws := make([]*Raw, len(pwds))
+
+	for i, pwd := range pwds {
+		r, err := cfg.Hash(pwd, salt)
+		if err != nil {
+			return nil, err
+		}
+		raws[i] = r
+	}
+
+	return raws, nil
+}
+
+// HashPadded works like Hash(), but zero-pads the resulting Raw.Hash to
+// `totalLen` bytes, which is useful for storage formats with fixed record sizes.
+// ErrIncorrectParameter is returned if `totalLen` is less than Config.HashLength.
+//
+// The true hash length is kept in Raw.Config.HashLength. Raw.Verify() compares
+// that many bytes and requires the remainder to be zero. Since the encoded and
+// binary representations can't express padding, Raw.Encode() and
+// Raw.MarshalBinary() omit it and the decoded Raw is no longer padded.
+func (c *Config) HashPadded(pwd []byte, salt []byte, totalLen uint32) (*Raw, error) {
+	if totalLen < c.HashLength {
+		return nil, ErrIncorrectParameter
+	}
+
+	r, err := c.Hash(pwd, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	padded := make([]byte, totalLen)
+	copy(padded, r.Hash)
+	r.Hash = padded
+	r.padded = true
+	return r, nil
+}
+
+// HashLen works like Hash(), but uses `hashLen` instead of Config.HashLength
+// for this call only. The returned Raw.Config reflects the length used.
+func (c *Config) HashLen(pwd []byte, salt []byte, hashLen uint32) (*Raw, error) {
+	cfg := *c
+	cfg.HashLength = hashLen
+	return cfg.Hash(pwd, salt)
+}
+
+// HashVersion works like Hash(), but uses the Version `v` instead of
+// Config.Version for this call only. The returned Raw.Config reflects `v`.
+func (c *Config) HashVersion(pwd []byte, salt []byte, v Version) (*Raw, error) {
+	cfg := *c
+	cfg.Version = v
+	return cfg.Hash(pwd, salt)
+}
+
+// HashDebug works like Hash(), but additionally returns the full output of
+// argon2 before its truncation to Config.HashLength, for debugging purposes.
+//
+// The reference implementation doesn't expose such an intermediate output:
+// The final block is fed into the variable-length hash function H', which
+// directly produces Config.HashLength bytes. `full` is thus always a copy of raw.Hash.
+func (c *Config) HashDebug(pwd []byte, salt []byte) (raw *Raw, full []byte, err error) {
+	raw, err = c.Hash(pwd, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, raw.HashCopy(), nil
+}
+
+// MemoryUsageBytes returns the amount of memory used by a hash, as
+// specified by Config.MemoryCost. See HashWithStats() for the actual usage.
+func (c *Config) MemoryUsageBytes() uint64 {
+	return uint64(c.MemoryCost) * 1024
+}
+
+// Stats contains statistics about a single hash. See Config.HashWithStats.
+type Stats struct {
+	// MemoryBytes is the amount of memory allocated by argon2.
+	MemoryBytes uint64
+
+	// Duration is the time spent computing the hash.
+	Duration time.Duration
+}
+
+// HashWithStats works like Hash(), but additionally returns Stats about the hash.
+//
+// The MemoryBytes are computed the same way argon2 does internally: The
+// MemoryCost is raised to at least 8 blocks of 1 KiB per lane and rounded down
+// to a multiple of 4 blocks per lane. It thus only matches MemoryUsageBytes()
+// if the MemoryCost is a multiple of 4 * Parallelism and at least 8 * Parallelism.
+func (c *Config) HashWithStats(pwd []byte, salt []byte) (*Raw, Stats, error) {
+	start := time.Now()
+	r, err := c.Hash(pwd, salt)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+
+	stats := Stats{Duration: time.Since(start)}
+
+	lanes := uint64(r.Config.Parallelism)
+	blocks := uint64(r.Config.MemoryCost)
+	if blocks < 2*C.ARGON2_SYNC_POINTS*lanes {
+		blocks = 2 * C.ARGON2_SYNC_POINTS * lanes
+	}
+	blocks -= blocks % (C.ARGON2_SYNC_POINTS * lanes)
+	stats.MemoryBytes = blocks * C.ARGON2_BLOCK_SIZE
+
+	return r, stats, nil
+}
+
+// LaneTimings contains the duration spent computing each lane of a hash.
+// See Config.HashInstrumented.
+type LaneTimings []time.Duration
+
+// HashInstrumented works like Hash(), but additionally records the time spent
+// computing each of the Config.Parallelism lanes, for side-channel research.
+//
+// The bundled reference implementation provides no instrumentation hooks,
+// which is why the returned LaneTimings are currently always empty.
+func (c *Config) HashInstrumented(pwd []byte, salt []byte) (*Raw, LaneTimings, error) {
+	r, err := c.Hash(pwd, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, LaneTimings{}, nil
+}
+
+// HashWithDerivedSalt works like Hash(), but uses the first Config.SaltLength
+// bytes of HMAC-SHA256(siteKey, identifier) as the salt. ErrIncorrectParameter
+// is returned if Config.SaltLength exceeds the 32 bytes of HMAC-SHA256.
+//
+// WARNING: Deterministic salts defeat much of the purpose of salting! Equal
+// passwords of the same identifier always result in equal hashes, and an
+// attacker knowing `siteKey` can precompute hashes for likely identifiers.
+// Only use this if your protocol requires a reproducible hash, as some SSO flows
+// do, and keep `siteKey` secret. Prefer Hash() with a random salt otherwise.
+func (c *Config) HashWithDerivedSalt(pwd []byte, identifier []byte, siteKey []byte) (*Raw, error) {
+	if c.SaltLength > sha256.Size {
+		return nil, ErrIncorrectParameter
+	}
+
+	mac := hmac.New(sha256.New, siteKey)
+	mac.Write(identifier)
+	salt := mac.Sum(nil)[:c.SaltLength]
+
+	return c.Hash(pwd, salt)
+}
+
+// HashContext works like Hash(), but returns ctx.Err() without hashing
+// if `ctx` is already done. Once started argon2 cannot be interrupted though.
+//
+// ErrNilContext is returned if `ctx` is nil.
+func (c *Config) HashContext(ctx context.Context, pwd []byte, salt []byte) (*Raw, error) {
+	if ctx == nil {
+		return nil, ErrNilContext
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Hash(pwd, salt)
+}
+
+// withDefaultParallelism returns `c` or, if Config.Parallelism is 0,
+// a copy of `c` with a Parallelism of 1.
+func (c *Config) withDefaultParallelism() *Config {
+	if c.Parallelism != 0 {
+		return c
+	}
+
+	cfg := *c
+	cfg.Parallelism = 1
+	return &cfg
+}
+
+// validate catches invalid parameters before calling into argon2,
+// which would otherwise only return an opaque error code.
+func (c *Config) validate(salt []byte) error {
+	if len(salt) < C.ARGON2_MIN_SALT_LENGTH {
+		return ErrSaltTooShort
+	}
+	if uint64(len(salt)) > C.ARGON2_MAX_SALT_LENGTH {
+		return ErrSaltTooLong
+	}
+	if c.Parallelism > C.ARGON2_MAX_LANES || c.Parallelism > C.ARGON2_MAX_THREADS {
+		return ErrParallelismTooHigh
+	}
+	return nil
 }
 
 // HashRaw is a helper function around Hash()
@@ -262,7 +1008,13 @@ func (c *Config) HashRaw(pwd []byte) (*Raw, error) {
 // generates a salt and encodes the result for you.
 //
 // It is recommended to use SecureZeroMemory(pwd) afterwards.
+// ErrUnsafeModeForPasswords is returned for ModeArgon2d,
+// unless Config.AllowArgon2dForPasswords is set.
 func (c *Config) HashEncoded(pwd []byte) (encoded []byte, err error) {
+	if c.Mode == ModeArgon2d && !c.AllowArgon2dForPasswords {
+		return nil, ErrUnsafeModeForPasswords
+	}
+
 	r, err := c.Hash(pwd, nil)
 	if err == nil {
 		encoded = r.Encode()
@@ -270,6 +1022,116 @@ func (c *Config) HashEncoded(pwd []byte) (encoded []byte, err error) {
 	return
 }
 
+// HashString works like HashEncoded(), but takes the password as a string,
+// whose bytes are passed to argon2 without copying them into a []byte first.
+//
+// This is safe, since argon2 only reads the password (ARGON2_FLAG_CLEAR_PASSWORD
+// is never set) and does not retain it beyond the call. Note however that the
+// string itself can't be wiped using SecureZeroMemory() afterwards.
+func (c *Config) HashString(pwd string) ([]byte, error) {
+	b := []byte{}
+	if len(pwd) > 0 {
+		b = unsafe.Slice(unsafe.StringData(pwd), len(pwd))
+	}
+	return c.HashEncoded(b)
+}
+
+// HashAndWipe works like HashEncoded(), but additionally clears
+// `pwd` using SecureZeroMemory() afterwards, even if an error occurred.
+func (c *Config) HashAndWipe(pwd []byte) ([]byte, error) {
+	defer SecureZeroMemory(pwd)
+	return c.HashEncoded(pwd)
+}
+
+// HashEncodedNoVersion works like HashEncoded(), but uses Version10 regardless
+// of Config.Version and omits the "$v=" segment. See EncodeLegacyNoVersion().
+//
+// Some older consumers, like certain PHP builds of password_verify(), fail to
+// parse the version segment and assume Version10 instead. Only use this for such
+// consumers, since Version10 is weaker than Version13. Use DecodeLegacy() to decode it.
+func (c *Config) HashEncodedNoVersion(pwd []byte) (encoded []byte, err error) {
+	cfg := *c
+	cfg.Version = Version10
+
+	if cfg.Mode == ModeArgon2d && !cfg.AllowArgon2dForPasswords {
+		return nil, ErrUnsafeModeForPasswords
+	}
+
+	r, err := cfg.Hash(pwd, nil)
+	if err == nil {
+		encoded = EncodeLegacyNoVersion(r)
+	}
+	return
+}
+
+// DeriveKey uses argon2 as a key derivation function and returns
+// a key of Config.HashLength bytes derived from `pwd` and `salt`.
+//
+// Contrary to Hash() a salt is required, since a randomly generated
+// salt would make the resulting key impossible to reproduce.
+func (c *Config) DeriveKey(pwd []byte, salt []byte) ([]byte, error) {
+	key := make([]byte, c.HashLength)
+
+	if err := c.HashTo(key, pwd, salt); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KnownAnswer returns the hash bytes for a known `pwd` and `salt` pair.
+//
+// It can be used to compare a build of this package against
+// previously recorded answers, ensuring that the binding hasn't drifted.
+func (c *Config) KnownAnswer(pwd []byte, salt []byte) ([]byte, error) {
+	return c.DeriveKey(pwd, salt)
+}
+
+// Verifier returns a deterministic verifier value for `pwd` and `salt`,
+// as needed by SRP-like authentication protocols.
+//
+// Contrary to Hash() the result is only the raw hash bytes, without the Config
+// and salt needed to recompute it, which is why it's unsuitable for password
+// storage. Like DeriveKey() a salt is required and no secret is used.
+func (c *Config) Verifier(pwd []byte, salt []byte) ([]byte, error) {
+	return c.DeriveKey(pwd, salt)
+}
+
+// DeriveKeys works like DeriveKey(), but computes a single argon2 output
+// of the summed `lengths` and splits it into one key per length.
+//
+// This is merely a convenience which saves you from running argon2 multiple
+// times. It is NOT a replacement for a proper KDF like HKDF.
+func (c *Config) DeriveKeys(pwd []byte, salt []byte, lengths ...uint32) ([][]byte, error) {
+	total := uint32(0)
+
+	for _, l := range lengths {
+		t := total + l
+		if t < total {
+			return nil, ErrOutputTooLong
+		}
+		total = t
+	}
+
+	cfg := *c
+	cfg.HashLength = total
+
+	key, err := cfg.DeriveKey(pwd, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, len(lengths))
+	off := uint32(0)
+
+	for i, l := range lengths {
+		end := off + l
+		keys[i] = key[off:end:end]
+		off = end
+	}
+
+	return keys, nil
+}
+
 // Raw wraps a salt and hash pair including the Config with which it was generated.
 //
 // A Raw struct is generated using Decode() or the Hash*() methods above.
@@ -284,15 +1146,270 @@ type Raw struct {
 	Config Config
 	Salt   []byte
 	Hash   []byte
+
+	// Data contains the associated data of hashes, which were decoded from
+	// a string containing a "data" attribute, as generated by older versions
+	// of the reference implementation. It's nil otherwise.
+	Data []byte
+
+	// KeyID identifies the secret in the Secrets registry the hash was
+	// created with by Config.HashWithSecret(). It's empty if no secret was used.
+	KeyID string
+
+	// SaltSource records where the salt was generated by Hash(): "crypto/rand"
+	// or the type name of a custom SaltReader. It's empty if the salt was
+	// passed in by the caller and it's not preserved by any encoding.
+	SaltSource string
+
+	// origConfig is a copy of Config recorded by Hash() if
+	// DetectConfigMutation is set. It's nil otherwise.
+	origConfig *Config
+
+	// padded is set by HashPadded(), in which case Hash
+	// is zero-padded beyond Config.HashLength bytes.
+	padded bool
+}
+
+// unpaddedHash returns raw.Hash without the padding added by HashPadded().
+func (raw *Raw) unpaddedHash() []byte {
+	if raw.padded && uint64(len(raw.Hash)) > uint64(raw.Config.HashLength) {
+		return raw.Hash[:raw.Config.HashLength]
+	}
+	return raw.Hash
+}
+
+// zeroPadding returns 1 if the padding added by HashPadded() consists
+// of zeros or if there's none and 0 otherwise, in constant time.
+func (raw *Raw) zeroPadding() int {
+	var tail byte
+	for _, b := range raw.Hash[len(raw.unpaddedHash()):] {
+		tail |= b
+	}
+	return subtle.ConstantTimeByteEq(tail, 0)
+}
+
+// matchHash compares `hash` with raw.Hash in constant time.
+// For hashes created by HashPadded() the padding must consist of zeros.
+func (raw *Raw) matchHash(hash []byte) bool {
+	return subtle.ConstantTimeCompare(hash, raw.unpaddedHash())&raw.zeroPadding() == 1
+}
+
+// HashCopy returns a copy of raw.Hash.
+//
+// Use it if you retain the hash beyond the lifetime of the Raw struct,
+// to prevent accidentally mutating or aliasing its internal slice.
+func (raw *Raw) HashCopy() []byte {
+	return append([]byte(nil), raw.Hash...)
+}
+
+// SaltCopy returns a copy of raw.Salt. See HashCopy().
+func (raw *Raw) SaltCopy() []byte {
+	return append([]byte(nil), raw.Salt...)
+}
+
+// Validate checks the Raw struct for consistency before it's stored: The lengths
+// of Salt and Hash must match Config.SaltLength and Config.HashLength, which is
+// otherwise reported as ErrInconsistentRaw, and the Mode and Version must be supported.
+//
+// Hashes created by HashPadded() are longer than Config.HashLength and thus fail this check.
+func (raw *Raw) Validate() error {
+	if uint64(len(raw.Salt)) != uint64(raw.Config.SaltLength) || uint64(len(raw.Hash)) != uint64(raw.Config.HashLength) {
+		return ErrInconsistentRaw
+	}
+
+	switch raw.Config.Mode {
+	case ModeArgon2d, ModeArgon2i, ModeArgon2id:
+	default:
+		return ErrIncorrectType
+	}
+
+	switch raw.Config.Version {
+	case Version10, Version13:
+	default:
+		return ErrIncorrectParameter
+	}
+
+	return nil
+}
+
+// DiffRaw returns the names of the fields, which differ between `a` and `b`,
+// like "Salt" or "Config.TimeCost", or nil if they're equal. It's meant for
+// debugging migrations and never reveals the contents of the fields.
+func DiffRaw(a, b *Raw) []string {
+	var diff []string
+	check := func(equal bool, name string) {
+		if !equal {
+			diff = append(diff, name)
+		}
+	}
+
+	ca, cb := &a.Config, &b.Config
+	check(ca.HashLength == cb.HashLength, "Config.HashLength")
+	check(ca.SaltLength == cb.SaltLength, "Config.SaltLength")
+	check(ca.TimeCost == cb.TimeCost, "Config.TimeCost")
+	check(ca.MemoryCost == cb.MemoryCost, "Config.MemoryCost")
+	check(ca.Parallelism == cb.Parallelism, "Config.Parallelism")
+	check(ca.Mode == cb.Mode, "Config.Mode")
+	check(ca.Version == cb.Version, "Config.Version")
+	check(bytes.Equal(a.Salt, b.Salt), "Salt")
+	check(bytes.Equal(a.Hash, b.Hash), "Hash")
+	check(bytes.Equal(a.Data, b.Data), "Data")
+	check(a.KeyID == b.KeyID, "KeyID")
+
+	return diff
+}
+
+// HashHex returns raw.Hash as a lowercase hex string.
+func (raw *Raw) HashHex() string {
+	return hex.EncodeToString(raw.Hash)
+}
+
+// SaltHex returns raw.Salt as a lowercase hex string.
+func (raw *Raw) SaltHex() string {
+	return hex.EncodeToString(raw.Salt)
+}
+
+// HexString returns a compact "mode:v:m:t:p:saltHex:hashHex" line,
+// e.g. "Argon2i:13:4096:3:1:73616c7473616c74:965bd4...". It's meant for
+// logging and is not understood by Decode(). See VerifyHex().
+func (raw *Raw) HexString() string {
+	c := &raw.Config
+	return c.Mode.String() + ":" +
+		c.Version.String() + ":" +
+		strconv.FormatUint(uint64(c.MemoryCost), 10) + ":" +
+		strconv.FormatUint(uint64(c.TimeCost), 10) + ":" +
+		strconv.FormatUint(uint64(c.Parallelism), 10) + ":" +
+		raw.SaltHex() + ":" +
+		raw.HashHex()
+}
+
+// verifySecret performs the checks shared by all verification methods and
+// returns the secret identified by raw.KeyID: ErrConfigMutated is returned if
+// DetectConfigMutation caught a modification of raw.Config after Hash().
+func (raw *Raw) verifySecret() ([]byte, error) {
+	if raw.origConfig != nil && *raw.origConfig != raw.Config {
+		return nil, ErrConfigMutated
+	}
+	return Secrets.lookup(raw.KeyID)
 }
 
 // Verify returns true if `pwd` matches the hash in `raw` and otherwise false.
 func (raw *Raw) Verify(pwd []byte) (bool, error) {
-	r, err := raw.Config.Hash(pwd, raw.Salt)
+	secret, err := raw.verifySecret()
+	if err != nil {
+		return false, err
+	}
+
+	r, err := raw.Config.hash(pwd, raw.Salt, raw.Data, raw.KeyID, secret)
+	if err != nil {
+		return false, wrapOp("verify", err)
+	}
+
+	return raw.matchHash(r.Hash), nil
+}
+
+// VerifyRawStreaming works like raw.Verify(), but computes and compares the
+// hash entirely in C, instead of allocating a second copy of it on the Go heap.
+// The temporary copy is wiped and freed right after the comparison.
+// Like raw.Verify() it returns ErrConfigMutated and handles HashPadded().
+//
+// Contrary to raw.Verify() the output length is taken from len(raw.Hash)
+// instead of Config.HashLength and OnHash is not invoked.
+//
+// This is only useful for abnormally long hashes, like derived keys of
+// several KiB, for which it halves the amount of garbage produced.
+func VerifyRawStreaming(raw *Raw, pwd []byte) (bool, error) {
+	secret, err := raw.verifySecret()
+	if err != nil {
+		return false, err
+	}
+
+	hash := raw.unpaddedHash()
+	c := &raw.Config
+	if err := c.checkInputs(len(hash), pwd, raw.Salt, raw.Data, secret); err != nil {
+		return false, wrapOp("verify", err)
+	}
+	if len(hash) == 0 {
+		return false, wrapOp("verify", ErrOutputTooShort)
+	}
+
+	c = c.withDefaultParallelism()
+
+	pwdptr, pwdlen := cbytes(pwd)
+	saltptr, saltlen := cbytes(raw.Salt)
+	secretptr, secretlen := cbytes(secret)
+	adptr, adlen := cbytes(raw.Data)
+	hashptr, hashlen := cbytes(hash)
+	match := C.int(0)
+
+	rc := C.bindings_argon2_verify(
+		(*C.struct_bindings_argon2_config)(unsafe.Pointer(c)),
+		pwdptr,
+		pwdlen,
+		saltptr,
+		saltlen,
+		secretptr,
+		secretlen,
+		adptr,
+		adlen,
+		hashptr,
+		hashlen,
+		&match,
+	)
+
+	if rc != C.ARGON2_OK {
+		return false, wrapOp("verify", Error(rc))
+	}
+
+	return int(match)&raw.zeroPadding() == 1, nil
+}
+
+// PrefixMatch works like Verify(), but only compares the first `prefixLen`
+// bytes of the hash. ErrIncorrectParameter is returned if `prefixLen` is not
+// within 1 and len(raw.Hash).
+//
+// WARNING: This is NOT a substitute for Verify()! A short prefix can be
+// matched by chance and thus only serves as a first-pass filter to reject
+// obviously wrong guesses, e.g. in rate limiters. Since the full hash needs
+// to be computed either way, it saves no time on the argon2 computation itself.
+func (raw *Raw) PrefixMatch(pwd []byte, prefixLen int) (bool, error) {
+	if prefixLen < 1 || prefixLen > len(raw.Hash) {
+		return false, ErrIncorrectParameter
+	}
+
+	secret, err := raw.verifySecret()
 	if err != nil {
 		return false, err
 	}
-	return subtle.ConstantTimeCompare(r.Hash, raw.Hash) == 1, nil
+
+	r, err := raw.Config.hash(pwd, raw.Salt, raw.Data, raw.KeyID, secret)
+	if err != nil {
+		return false, wrapOp("verify", err)
+	}
+	if prefixLen > len(r.Hash) {
+		return false, ErrIncorrectParameter
+	}
+
+	return subtle.ConstantTimeCompare(r.Hash[:prefixLen], raw.Hash[:prefixLen]) == 1, nil
+}
+
+// SaltLooksWeak returns true if the salt is empty, consists of a single
+// repeated byte (like all zeros) or otherwise contains very few distinct bytes.
+//
+// This is merely a heuristic for auditing legacy data, where such salts are
+// a sign of a broken random number generator. Affected hashes should be rehashed.
+func (raw *Raw) SaltLooksWeak() bool {
+	var seen [256]bool
+	distinct := 0
+
+	for _, b := range raw.Salt {
+		if !seen[b] {
+			seen[b] = true
+			distinct++
+		}
+	}
+
+	return distinct <= 1 || distinct < len(raw.Salt)/4
 }
 
 // VerifyEncoded returns true if `pwd` matches the encoded hash `encoded` and otherwise false.
@@ -304,6 +1421,259 @@ func VerifyEncoded(pwd []byte, encoded []byte) (bool, error) {
 	return r.Verify(pwd)
 }
 
+// VerifyEncodedPrefixed works like VerifyEncoded(), but first strips `prefix`
+// from `stored`, as generated by Raw.EncodePrefixed().
+//
+// ErrMissingPrefix is returned if `stored` does not start with `prefix`.
+func VerifyEncodedPrefixed(pwd []byte, stored []byte, prefix string) (bool, error) {
+	if !bytes.HasPrefix(stored, []byte(prefix)) {
+		return false, ErrMissingPrefix
+	}
+	return VerifyEncoded(pwd, stored[len(prefix):])
+}
+
+// VerifyEncodedConfig works like VerifyEncoded(), but additionally returns
+// the Config decoded from `encoded`, e.g. to decide whether to rehash the password.
+// `cfg` is only nil if `encoded` failed to decode.
+func VerifyEncodedConfig(pwd []byte, encoded []byte) (ok bool, cfg *Config, err error) {
+	r, err := Decode(encoded)
+	if err != nil {
+		return false, nil, err
+	}
+
+	ok, err = r.Verify(pwd)
+	return ok, &r.Config, err
+}
+
+// VerifyWithConfig works like VerifyEncoded(), but returns ErrVersionMismatch
+// if the Version of `encoded` differs from the one of `cfg`. The hash itself is
+// always verified using the parameters of `encoded`, just like VerifyEncoded() does.
+func VerifyWithConfig(pwd []byte, encoded []byte, cfg *Config) (bool, error) {
+	r, err := Decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	if r.Config.Version != cfg.Version {
+		return false, ErrVersionMismatch
+	}
+	return r.Verify(pwd)
+}
+
+// VerifyEncodedAllowed works like VerifyEncoded(), but returns ErrModeNotAllowed
+// if the Mode of `encoded` is not one of the `allowed` ones. This is useful
+// while migrating stored hashes from one mode to another.
+func VerifyEncodedAllowed(pwd []byte, encoded []byte, allowed ...Mode) (bool, error) {
+	r, err := Decode(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	for _, m := range allowed {
+		if r.Config.Mode == m {
+			return r.Verify(pwd)
+		}
+	}
+
+	return false, ErrModeNotAllowed
+}
+
+// VerifyEncodedWithSalt works like VerifyEncoded(), but for encoded hashes
+// from which the salt segment has been omitted, like "$argon2id$v=19$m=...$hash".
+// The salt is instead given separately as `salt`.
+func VerifyEncodedWithSalt(pwd []byte, encodedNoSalt []byte, salt []byte) (bool, error) {
+	i := bytes.LastIndexByte(encodedNoSalt, '$')
+	if i < 0 {
+		return false, ErrDecodingFail
+	}
+
+	buf := make([]byte, 0, len(encodedNoSalt)+enc64.EncodedLen(len(salt))+1)
+	buf = append(buf, encodedNoSalt[:i+1]...)
+	buf = appendBase64(buf, salt, 0)
+	buf = append(buf, encodedNoSalt[i:]...)
+
+	r, err := Decode(buf)
+	if err != nil {
+		return false, err
+	}
+	return r.Verify(pwd)
+}
+
+// WouldMatch returns whether `pwd` matches the encoded hash `a` and `b` respectively.
+// It's meant for testing migrations from one encoded hash to another.
+func WouldMatch(pwd []byte, a []byte, b []byte) (bool, bool, error) {
+	ra, err := Decode(a)
+	if err != nil {
+		return false, false, err
+	}
+
+	rb, err := Decode(b)
+	if err != nil {
+		return false, false, err
+	}
+
+	okA, err := ra.Verify(pwd)
+	if err != nil {
+		return false, false, err
+	}
+
+	okB, err := rb.Verify(pwd)
+	if err != nil {
+		return false, false, err
+	}
+
+	return okA, okB, nil
+}
+
+// InDenylist returns true if `pwd` matches any of the hashes in `denylist`.
+//
+// Each entry is verified using Raw.Verify() until the first match is found.
+// Since every entry requires a full argon2 computation the cost of
+// this function scales linearly with the size of the denylist.
+func InDenylist(pwd []byte, denylist []*Raw) (bool, error) {
+	for _, r := range denylist {
+		ok, err := r.Verify(pwd)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Policy specifies the range of parameters an encoded hash may use.
+// A maximum of 0 means that the respective parameter is unbounded.
+type Policy struct {
+	MinTimeCost    uint32
+	MaxTimeCost    uint32
+	MinMemoryCost  uint32
+	MaxMemoryCost  uint32
+	MinParallelism uint32
+	MaxParallelism uint32
+}
+
+// Check returns ErrPolicyViolation if any parameter of `c` lies outside the Policy.
+func (p *Policy) Check(c *Config) error {
+	if !inRange(c.TimeCost, p.MinTimeCost, p.MaxTimeCost) ||
+		!inRange(c.MemoryCost, p.MinMemoryCost, p.MaxMemoryCost) ||
+		!inRange(c.Parallelism, p.MinParallelism, p.MaxParallelism) {
+		return ErrPolicyViolation
+	}
+	return nil
+}
+
+func inRange(v, min, max uint32) bool {
+	return v >= min && (max == 0 || v <= max)
+}
+
+// VerifyEncodedBounded works like VerifyEncoded(), but refuses to verify
+// `encoded` if its parameters fall outside the given Policy.
+//
+// This prevents tampered hashes with trivially cheap parameters
+// (e.g. "t=1,m=8") from being accepted, as well as hashes with
+// excessive parameters from being used for denial of service attacks.
+func VerifyEncodedBounded(pwd []byte, encoded []byte, policy Policy) (bool, error) {
+	r, err := Decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	if err := policy.Check(&r.Config); err != nil {
+		return false, err
+	}
+	return r.Verify(pwd)
+}
+
+// VerifyHex returns true if `pwd` matches the hex encoded hash `hashHex`,
+// which was generated using `cfg` and the hex encoded salt `saltHex`.
+//
+// This is useful for legacy systems which store the raw salt and hash as hex
+// instead of the encoded argon2 representation.
+func VerifyHex(pwd []byte, cfg *Config, saltHex, hashHex string) (bool, error) {
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return false, err
+	}
+
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		return false, err
+	}
+
+	r := Raw{
+		Config: *cfg,
+		Salt:   salt,
+		Hash:   hash,
+	}
+	r.Config.HashLength = uint32(len(hash))
+	r.Config.SaltLength = uint32(len(salt))
+	return r.Verify(pwd)
+}
+
+// VerifyConcat returns true if `pwd` matches the hash in `blob`, which was
+// generated using `cfg` and stored as the concatenation of the hash and salt.
+// The first `hashLen` bytes of `blob` are the hash and the remainder is the salt.
+//
+// This is useful for migrating legacy systems which stored both in one column.
+func VerifyConcat(pwd []byte, cfg *Config, blob []byte, hashLen int) (bool, error) {
+	if hashLen < 1 || hashLen > len(blob) {
+		return false, ErrIncorrectParameter
+	}
+
+	r := Raw{
+		Config: *cfg,
+		Salt:   blob[hashLen:],
+		Hash:   blob[:hashLen],
+	}
+	r.Config.HashLength = uint32(len(r.Hash))
+	r.Config.SaltLength = uint32(len(r.Salt))
+	return r.Verify(pwd)
+}
+
+// A single NDJSON record written by HashStream().
+type streamRecord struct {
+	Salt    []byte `json:"salt"`
+	Hash    []byte `json:"hash"`
+	Encoded string `json:"encoded"`
+}
+
+// HashStream hashes every password received from `in` using `cfg` until `in`
+// is closed and writes one JSON object per line to `out`, containing the
+// base64 encoded "salt" and "hash", as well as the "encoded" hash.
+//
+// Each password buffer is wiped using SecureZeroMemory() after hashing.
+// If an error occurs HashStream returns immediately without draining `in`.
+func HashStream(cfg *Config, in <-chan []byte, out io.Writer) error {
+	enc := json.NewEncoder(out)
+
+	for pwd := range in {
+		r, err := cfg.HashRaw(pwd)
+		SecureZeroMemory(pwd)
+
+		if err != nil {
+			return err
+		}
+
+		err = enc.Encode(streamRecord{
+			Salt:    r.Salt,
+			Hash:    r.Hash,
+			Encoded: string(r.Encode()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// wipe works like SecureZeroMemory(), but only wipes up to len(b).
+func wipe(b []byte) {
+	if len(b) > 0 {
+		C.secure_wipe_memory(unsafe.Pointer(&b[0]), C.size_t(len(b)))
+	}
+}
+
 // SecureZeroMemory is a helper method which as securely as possible sets all
 // bytes in `b` (up to it's capacity) to `0x00`, erasing it's contents.
 //
@@ -312,10 +1682,16 @@ func VerifyEncoded(pwd []byte, encoded []byte) (bool, error) {
 //
 // This method uses SecureZeroMemory() on Windows, memset_s() if available,
 // explicit_bzero() on OpenBSD, or a plain memset() as a fallback.
+//
+// It must not be called concurrently on overlapping memory. Building with the
+// "argon2_debug" tag makes it panic if such a concurrent wipe is detected.
 func SecureZeroMemory(b []byte) {
 	c := cap(b)
 	if c > 0 {
 		b = b[:c:c]
-		C.secure_wipe_memory(unsafe.Pointer(&b[0]), C.size_t(c))
+		p := unsafe.Pointer(&b[0])
+		wipeBegin(uintptr(p), c)
+		C.secure_wipe_memory(p, C.size_t(c))
+		wipeEnd(uintptr(p))
 	}
 }
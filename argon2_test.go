@@ -5,10 +5,25 @@
 package argon2
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 var (
@@ -52,6 +67,319 @@ func mustBeTruthy(t *testing.T, name string, obj interface{}) {
 	}
 }
 
+func TestSupportedModes(t *testing.T) {
+	expected := []Mode{ModeArgon2d, ModeArgon2i, ModeArgon2id}
+
+	if modes := SupportedModes(); !reflect.DeepEqual(modes, expected) {
+		t.Errorf("unexpected modes: %v", modes)
+	}
+}
+
+func TestSupportedVersions(t *testing.T) {
+	expected := []Version{Version10, Version13}
+
+	if versions := SupportedVersions(); !reflect.DeepEqual(versions, expected) {
+		t.Errorf("unexpected versions: %v", versions)
+	}
+}
+
+func TestConfigForThreat(t *testing.T) {
+	expected := map[ThreatModel]Mode{
+		ThreatSideChannelSensitive: ModeArgon2i,
+		ThreatGPUResistant:         ModeArgon2d,
+		ThreatBalanced:             ModeArgon2id,
+	}
+
+	for threat, mode := range expected {
+		cfg := ConfigForThreat(threat)
+		if cfg.Mode != mode {
+			t.Errorf("threat %d: expected %s, got %s", threat, mode, cfg.Mode)
+		}
+
+		// Only ThreatGPUResistant requires opting into ModeArgon2d for passwords.
+		_, err := cfg.HashEncoded(password)
+		if threat == ThreatGPUResistant {
+			if err != ErrUnsafeModeForPasswords {
+				t.Errorf("threat %d: expected ErrUnsafeModeForPasswords, got: %v", threat, err)
+			}
+			cfg.AllowArgon2dForPasswords = true
+			_, err = cfg.HashEncoded(password)
+		}
+		if err != nil {
+			t.Errorf("threat %d: HashEncoded failed: %v", threat, err)
+		}
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	cfg := Config{MemoryCost: 1 << 16}.WithDefaults()
+
+	expected := DefaultConfig()
+	expected.MemoryCost = 1 << 16
+
+	if cfg != expected {
+		t.Logf("ref: %v", expected)
+		t.Logf("act: %v", cfg)
+		t.Error("configs do not match")
+	}
+}
+
+func TestWithScaledCost(t *testing.T) {
+	cfg := config.WithScaledCost(2.0)
+
+	if cfg.TimeCost != 2*config.TimeCost || cfg.MemoryCost != 2*config.MemoryCost {
+		t.Errorf("costs must be doubled: %v", cfg)
+	}
+
+	cfg = config.WithScaledCost(1e12)
+
+	if cfg.MemoryCost != MaxMemory {
+		t.Errorf("memory cost must be clamped at %d, got: %d", MaxMemory, cfg.MemoryCost)
+	}
+
+	if cfg = config.WithScaledCost(math.Inf(1)); cfg.TimeCost != math.MaxUint32 || cfg.MemoryCost != MaxMemory {
+		t.Errorf("+Inf must result in the maximum costs, got: %v", cfg)
+	}
+
+	for _, factor := range []float64{math.NaN(), math.Inf(-1), 0, -1} {
+		if cfg := config.WithScaledCost(factor); cfg.TimeCost != 1 || cfg.MemoryCost != 8 {
+			t.Errorf("factor %v must result in the minimum costs, got: %v", factor, cfg)
+		}
+	}
+}
+
+func TestAtLeastAsStrong(t *testing.T) {
+	a := DefaultConfig()
+
+	b := a
+	b.TimeCost++
+	b.Mode = ModeArgon2id
+
+	if !AtLeastAsStrong(&a, &b) {
+		t.Error("a stronger config must be at least as strong")
+	}
+
+	if !AtLeastAsStrong(&a, &a) {
+		t.Error("an equal config must be at least as strong")
+	}
+
+	if AtLeastAsStrong(&b, &a) {
+		t.Error("a weaker config must not be at least as strong")
+	}
+
+	c := a
+	c.Mode = ModeArgon2d
+
+	if AtLeastAsStrong(&a, &c) {
+		t.Error("ModeArgon2d must be weaker than ModeArgon2i")
+	}
+}
+
+func TestGenerateSalt(t *testing.T) {
+	a, err := GenerateSalt(16)
+	mustBeFalsey(t, "err1", err)
+
+	b, err := GenerateSalt(16)
+	mustBeFalsey(t, "err2", err)
+
+	if len(a) != 16 || len(b) != 16 {
+		t.Errorf("unexpected salt lengths: %d, %d", len(a), len(b))
+	}
+
+	if bytes.Equal(a, b) {
+		t.Error("salts must be unique")
+	}
+
+	for _, n := range []int{0, -1} {
+		if _, err := GenerateSalt(n); err == nil {
+			t.Errorf("GenerateSalt(%d) must fail", n)
+		}
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	info := BuildInfo()
+
+	if v := info["version"]; v != Version13.String() {
+		t.Errorf("unexpected version: %q", v)
+	}
+
+	if v := info["threads"]; v != "true" && v != "false" {
+		t.Errorf("unexpected threads: %q", v)
+	}
+
+	if info["simd"] == "" {
+		t.Error("simd must not be empty")
+	}
+}
+
+// TestGolden asserts exact output bytes for several configurations.
+// Running it on multiple architectures catches layout bugs
+// in the Config struct, which is passed to C by pointer.
+func TestGolden(t *testing.T) {
+	data, err := os.ReadFile("testdata/golden.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []struct {
+		Mode        string `json:"mode"`
+		Version     uint32 `json:"version"`
+		MemoryCost  uint32 `json:"memoryCost"`
+		TimeCost    uint32 `json:"timeCost"`
+		Parallelism uint32 `json:"parallelism"`
+		Password    string `json:"password"`
+		Salt        string `json:"salt"`
+		Hash        string `json:"hash"`
+	}
+
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	modes := map[string]Mode{}
+	for _, m := range SupportedModes() {
+		modes[m.String()] = m
+	}
+
+	for i, v := range vectors {
+		s, _ := hex.DecodeString(v.Salt)
+		cfg := Config{
+			HashLength:  uint32(len(v.Hash) / 2),
+			TimeCost:    v.TimeCost,
+			MemoryCost:  v.MemoryCost,
+			Parallelism: v.Parallelism,
+			Mode:        modes[v.Mode],
+			Version:     Version(v.Version),
+		}
+
+		r, err := cfg.Hash([]byte(v.Password), s)
+		if err != nil {
+			t.Errorf("vector %d: %v", i, err)
+			continue
+		}
+
+		if h := hex.EncodeToString(r.Hash); h != v.Hash {
+			t.Errorf("vector %d: expected %s, got %s", i, v.Hash, h)
+		}
+	}
+}
+
+// TestEmptyInputs compares hashes of an empty password against outputs of
+// golang.org/x/crypto/argon2 and ensures that an empty salt is rejected.
+func TestEmptyInputs(t *testing.T) {
+	for mode, ref := range map[Mode]string{
+		ModeArgon2i:  "a65a1b22ead583569e17ad5ad50232a042d52ece27112ee10ba06b8192cc20d7",
+		ModeArgon2id: "1280ffe3c491044bc6231eed8b77fbf9862dd25e6133daffdc8e2d376d921c2c",
+	} {
+		cfg := config
+		cfg.Mode = mode
+
+		r, err := cfg.Hash([]byte{}, salt)
+		mustBeFalsey(t, "err", err)
+
+		if act := hex.EncodeToString(r.Hash); act != ref {
+			t.Logf("ref: %s", ref)
+			t.Logf("act: %s", act)
+			t.Errorf("%v: hashes do not match", mode)
+		}
+	}
+
+	for _, s := range [][]byte{{}, nil} {
+		if _, err := config.DeriveKey(password, s); !errors.Is(err, ErrSaltTooShort) {
+			t.Errorf("expected ErrSaltTooShort, got: %v", err)
+		}
+	}
+}
+
+// TestPasslib verifies hashes generated by Python's passlib.
+// Older versions of passlib omit the version segment, which requires DecodeLegacy().
+func TestPasslib(t *testing.T) {
+	data, err := os.ReadFile("testdata/passlib.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []struct {
+		Comment  string `json:"comment"`
+		Password string `json:"password"`
+		Encoded  string `json:"encoded"`
+		Legacy   bool   `json:"legacy"`
+	}
+
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range vectors {
+		decode := Decode
+		if v.Legacy {
+			decode = DecodeLegacy
+		}
+
+		r, err := decode([]byte(v.Encoded))
+		if err != nil {
+			t.Errorf("vector %d (%s): %v", i, v.Comment, err)
+			continue
+		}
+
+		if ok, err := r.Verify([]byte(v.Password)); !ok || err != nil {
+			t.Errorf("vector %d (%s): expected a match, got %v, %v", i, v.Comment, ok, err)
+		}
+
+		if ok, err := r.Verify([]byte(v.Password + "x")); ok || err != nil {
+			t.Errorf("vector %d (%s): expected a mismatch, got %v, %v", i, v.Comment, ok, err)
+		}
+
+		if enc := r.Encode(); !v.Legacy && string(enc) != v.Encoded {
+			t.Errorf("vector %d (%s): expected %s, got %s", i, v.Comment, v.Encoded, enc)
+		}
+	}
+}
+
+// VerifyWipe works like Raw.Verify(), but wipes `pwd` after hashing, as well
+// as the recomputed hash. It's used to audit that no plaintext lingers after
+// verification. `pwd` must not be reused after calling this method.
+func (raw *Raw) VerifyWipe(pwd []byte) (bool, error) {
+	secret, err := raw.verifySecret()
+	if err != nil {
+		SecureZeroMemory(pwd)
+		return false, err
+	}
+
+	r, err := raw.Config.hash(pwd, raw.Salt, raw.Data, raw.KeyID, secret)
+	SecureZeroMemory(pwd)
+
+	if err != nil {
+		return false, err
+	}
+
+	ok := raw.matchHash(r.Hash)
+	SecureZeroMemory(r.Hash)
+	return ok, nil
+}
+
+func TestJSONSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]interface{} `json:"properties"`
+		Required   []string               `json:"required"`
+	}
+
+	if err := json.Unmarshal(config.JSONSchema(), &schema); err != nil {
+		t.Fatalf("schema must be valid JSON: %v", err)
+	}
+
+	for _, field := range []string{"HashLength", "SaltLength", "TimeCost", "MemoryCost", "Parallelism", "Mode", "Version"} {
+		if _, ok := schema.Properties[field]; !ok {
+			t.Errorf("schema is missing the %s property", field)
+		}
+	}
+
+	if len(schema.Required) != 7 {
+		t.Errorf("unexpected required fields: %v", schema.Required)
+	}
+}
+
 func TestHashRaw(t *testing.T) {
 	r, err := config.HashRaw(password)
 	mustBeTruthy(t, "r.Config", r.Config)
@@ -76,6 +404,24 @@ func TestHashEncoded(t *testing.T) {
 	}
 }
 
+func TestHashEncodedArgon2d(t *testing.T) {
+	cfg := config
+	cfg.Mode = ModeArgon2d
+
+	enc, err := cfg.HashEncoded(password)
+	mustBeFalsey(t, "encoded", enc)
+
+	if err != ErrUnsafeModeForPasswords {
+		t.Errorf("expected ErrUnsafeModeForPasswords, got: %v", err)
+	}
+
+	cfg.AllowArgon2dForPasswords = true
+
+	enc, err = cfg.HashEncoded(password)
+	mustBeTruthy(t, "encoded", enc)
+	mustBeFalsey(t, "err", err)
+}
+
 func TestHashWithSalt(t *testing.T) {
 	r, err := config.Hash(password, salt)
 	mustBeTruthy(t, "r.Config", r.Config)
@@ -99,80 +445,2336 @@ func TestHashWithSalt(t *testing.T) {
 	}
 }
 
-func TestVerifyRaw(t *testing.T) {
-	r, err := config.HashRaw(password)
-	mustBeTruthy(t, "r.Config", r.Config)
-	mustBeTruthy(t, "r.Salt", r.Salt)
-	mustBeTruthy(t, "r.Hash", r.Hash)
+func TestHashShared(t *testing.T) {
+	pwds := [][]byte{[]byte("foo"), []byte("bar")}
+
+	raws, err := HashShared(nil, &config, pwds...)
+	mustBeFalsey(t, "err1", err)
+
+	if len(raws) != len(pwds) {
+		t.Fatalf("expected %d raws, got %d", len(pwds), len(raws))
+	}
+
+	for i, r := range raws {
+		if !bytes.Equal(r.Salt, raws[0].Salt) {
+			t.Errorf("raw %d does not share the salt", i)
+		}
+
+		ok, err := r.Verify(pwds[i])
+		mustBeFalsey(t, "err2", err)
+
+		if !ok {
+			t.Errorf("raw %d should match", i)
+		}
+	}
+}
+
+func TestHashPadded(t *testing.T) {
+	r, err := config.HashPadded(password, salt, 64)
 	mustBeFalsey(t, "err1", err)
 
+	if len(r.Hash) != 64 || r.Config.HashLength != 32 {
+		t.Fatalf("unexpected lengths: %d, %d", len(r.Hash), r.Config.HashLength)
+	}
+
+	if !bytes.Equal(r.Hash[:32], expectedHash) || !bytes.Equal(r.Hash[32:], make([]byte, 32)) {
+		t.Errorf("unexpected padded hash: %v", r.Hash)
+	}
+
 	ok, err := r.Verify(password)
-	mustBeTruthy(t, "ok", ok)
 	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("padded hash should match")
+	}
+
+	ok, err = VerifyRawStreaming(r, password)
+	mustBeFalsey(t, "err3", err)
+
+	if !ok {
+		t.Error("padded hash should match when streaming")
+	}
+
+	r2, err := Decode(r.Encode())
+	mustBeFalsey(t, "err4", err)
+
+	if !bytes.Equal(r2.Hash, expectedHash) {
+		t.Errorf("padding must not be encoded: %v", r2.Hash)
+	}
+
+	// Non-zero padding must be rejected.
+	r.Hash[63] = 1
+	ok, err = r.Verify(password)
+	mustBeFalsey(t, "err5", err)
+
+	if ok {
+		t.Error("non-zero padding must not match")
+	}
+
+	ok, err = VerifyRawStreaming(r, password)
+	mustBeFalsey(t, "err6", err)
+
+	if ok {
+		t.Error("non-zero padding must not match when streaming")
+	}
+
+	// Only hashes created by HashPadded() may be padded.
+	r3 := Raw{Config: config, Salt: salt, Hash: append(append([]byte(nil), expectedHash...), 0)}
+	ok, err = r3.Verify(password)
+	mustBeFalsey(t, "err7", err)
+
+	if ok {
+		t.Error("unexpectedly long hash must not match")
+	}
+
+	if _, err := config.HashPadded(password, salt, 16); err == nil {
+		t.Error("totalLen below HashLength must be rejected")
+	}
 }
 
-func TestVerifyEncoded(t *testing.T) {
-	encoded, err := config.HashEncoded(password)
-	mustBeTruthy(t, "encoded", encoded)
+func TestHashLen(t *testing.T) {
+	cfg := config
+
+	r16, err := cfg.HashLen(password, salt, 16)
 	mustBeFalsey(t, "err1", err)
 
-	ok, err := VerifyEncoded(password, encoded)
-	mustBeTruthy(t, "ok", ok)
+	r64, err := cfg.HashLen(password, salt, 64)
 	mustBeFalsey(t, "err2", err)
+
+	if len(r16.Hash) != 16 || r16.Config.HashLength != 16 {
+		t.Errorf("unexpected 16 byte result: %d, %d", len(r16.Hash), r16.Config.HashLength)
+	}
+
+	if len(r64.Hash) != 64 || r64.Config.HashLength != 64 {
+		t.Errorf("unexpected 64 byte result: %d, %d", len(r64.Hash), r64.Config.HashLength)
+	}
+
+	if cfg.HashLength != config.HashLength {
+		t.Error("HashLen must not modify the Config")
+	}
+
+	ok, err := r64.Verify(password)
+	mustBeFalsey(t, "err3", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
 }
 
-func TestSecureZeroMemory(t *testing.T) {
-	pwd := append([]byte(nil), password...)
+func TestHashVersion(t *testing.T) {
+	for _, v := range []Version{Version10, Version13} {
+		r, err := config.HashVersion(password, salt, v)
+		mustBeFalsey(t, "err1", err)
 
-	// SecureZeroMemory should erase up to cap(pwd) --> let's test that too
-	SecureZeroMemory(pwd[0:0])
+		if r.Config.Version != v {
+			t.Errorf("expected version %v, got %v", v, r.Config.Version)
+		}
 
-	for _, b := range pwd {
-		if b != 0 {
-			t.Error("pwd must only contain 0x00")
+		ok, err := VerifyEncoded(password, r.Encode())
+		mustBeFalsey(t, "err2", err)
+
+		if !ok {
+			t.Errorf("%v hash should match", v)
 		}
 	}
+
+	if config.Version != Version13 {
+		t.Error("HashVersion must not modify the Config")
+	}
 }
 
-func BenchmarkHash(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		_, _ = config.Hash(password, salt)
+func TestHexString(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	hashHex := r.HashHex()
+	saltHex := r.SaltHex()
+
+	if len(hashHex) != 2*len(r.Hash) || len(saltHex) != 2*len(r.Salt) {
+		t.Fatalf("unexpected hex lengths: %d, %d", len(hashHex), len(saltHex))
+	}
+
+	ok, err := VerifyHex(password, &r.Config, saltHex, hashHex)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hex round-trip should match")
+	}
+
+	ref := "Argon2i:13:4096:3:1:" + saltHex + ":" + hashHex
+	act := r.HexString()
+
+	if act != ref {
+		t.Logf("ref: %s", ref)
+		t.Logf("act: %s", act)
+		t.Error("HexString mismatch")
 	}
 }
 
-func BenchmarkVerify(b *testing.B) {
-	r, err := config.Hash(password, salt)
-	if err != nil {
-		b.Error(err)
+func TestConfigFromTOML(t *testing.T) {
+	data := []byte(`
+title = "service"
+
+[argon2]
+mode = "argon2id" # recommended
+version = "13"
+hash_length = 32
+time_cost = 2
+memory_cost = 19_456
+parallelism = 1
+
+[database]
+time_cost = 99
+`)
+
+	cfg, err := ConfigFromTOML(data)
+	mustBeFalsey(t, "err1", err)
+
+	ref := DefaultConfig()
+	ref.Mode = ModeArgon2id
+	ref.TimeCost = 2
+	ref.MemoryCost = 19456
+	ref.Parallelism = 1
+
+	if cfg != ref {
+		t.Logf("ref: %+v", ref)
+		t.Logf("act: %+v", cfg)
+		t.Error("unexpected config")
 	}
 
-	b.ResetTimer()
+	if _, err := ConfigFromTOML([]byte("[argon2]\ntime_cost = \"x\"")); err != ErrInvalidTOML {
+		t.Errorf("expected ErrInvalidTOML, got %v", err)
+	}
 
-	for i := 0; i < b.N; i++ {
-		_, _ = r.Verify(password)
+	if _, err := ConfigFromTOML([]byte("[argon2]\nmode = \"scrypt\"")); !errors.Is(err, ErrIncorrectType) {
+		t.Errorf("expected ErrIncorrectType, got %v", err)
 	}
 }
 
-func BenchmarkEncode(b *testing.B) {
-	r, err := config.Hash(password, salt)
-	if err != nil {
-		b.Error(err)
+func TestHashParallelismZero(t *testing.T) {
+	cfg := config
+	cfg.Parallelism = 0
+
+	r, err := cfg.Hash(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	if r.Config.Parallelism != 1 {
+		t.Errorf("expected Parallelism 1, got %d", r.Config.Parallelism)
 	}
 
-	b.SetBytes(int64(len(expectedEncoded)))
-	b.ResetTimer()
+	if !bytes.Equal(r.Hash, expectedHash) {
+		t.Logf("ref: %v", expectedHash)
+		t.Logf("act: %v", r.Hash)
+		t.Error("Parallelism 0 should hash like 1")
+	}
 
-	for i := 0; i < b.N; i++ {
-		_ = r.Encode()
+	ok, err := VerifyEncoded(password, r.Encode())
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
 	}
 }
 
-func BenchmarkDecode(b *testing.B) {
-	b.SetBytes(int64(len(expectedEncoded)))
-	b.ResetTimer()
+func TestVerifyEncodedWithSalt(t *testing.T) {
+	r, err := config.Hash(password, nil)
+	mustBeFalsey(t, "err1", err)
 
-	for i := 0; i < b.N; i++ {
-		_, _ = Decode(expectedEncoded)
+	// A custom encoding omitting the salt segment.
+	enc := r.Encode()
+	i := bytes.LastIndexByte(enc, '$')
+	j := bytes.LastIndexByte(enc[:i], '$')
+	encNoSalt := append(enc[:j:j], enc[i:]...)
+
+	ok, err := VerifyEncodedWithSalt(password, encNoSalt, r.Salt)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	ok, err = VerifyEncodedWithSalt(password, encNoSalt, salt)
+	mustBeFalsey(t, "err3", err)
+
+	if ok {
+		t.Error("hash shouldn't match with a different salt")
+	}
+}
+
+func TestDefaultMode(t *testing.T) {
+	if DefaultConfig().Mode != ModeArgon2i {
+		t.Fatal("the default mode must be ModeArgon2i")
+	}
+
+	defer func(m Mode) { DefaultMode = m }(DefaultMode)
+	DefaultMode = ModeArgon2id
+
+	if DefaultConfig().Mode != ModeArgon2id {
+		t.Error("DefaultConfig() should use DefaultMode")
+	}
+}
+
+func TestGenerateSalts(t *testing.T) {
+	salts, err := GenerateSalts(100, 16)
+	mustBeFalsey(t, "err", err)
+
+	if len(salts) != 100 {
+		t.Fatalf("expected 100 salts, got %d", len(salts))
+	}
+
+	seen := map[string]bool{}
+	for i, s := range salts {
+		if len(s) != 16 || cap(s) != 16 {
+			t.Errorf("salt %d has an unexpected length: %d, %d", i, len(s), cap(s))
+		}
+		if seen[string(s)] {
+			t.Errorf("salt %d is not distinct", i)
+		}
+		seen[string(s)] = true
+	}
+
+	if _, err := GenerateSalts(-1, 16); !errors.Is(err, ErrIncorrectParameter) {
+		t.Errorf("expected ErrIncorrectParameter, got: %v", err)
+	}
+
+	if _, err := GenerateSalts(1, 0); !errors.Is(err, ErrSaltTooShort) {
+		t.Errorf("expected ErrSaltTooShort, got: %v", err)
+	}
+}
+
+func TestSaltSource(t *testing.T) {
+	r, err := config.Hash(password, nil)
+	mustBeFalsey(t, "err1", err)
+
+	if r.SaltSource != "crypto/rand" {
+		t.Errorf("unexpected SaltSource: %q", r.SaltSource)
+	}
+
+	r, err = config.Hash(password, salt)
+	mustBeFalsey(t, "err2", err)
+
+	if r.SaltSource != "" {
+		t.Errorf("SaltSource should be empty for a given salt, but is: %q", r.SaltSource)
+	}
+
+	if fipsMode {
+		t.Skip("custom SaltReaders are not permitted in FIPS mode")
+	}
+
+	defer func(r io.Reader) { SaltReader = r }(SaltReader)
+	SaltReader = bytes.NewReader(make([]byte, 64))
+
+	r, err = config.Hash(password, nil)
+	mustBeFalsey(t, "err3", err)
+
+	if r.SaltSource != "*bytes.Reader" {
+		t.Errorf("unexpected SaltSource: %q", r.SaltSource)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	v1, err := config.Verifier(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	v2, err := config.Verifier(password, salt)
+	mustBeFalsey(t, "err2", err)
+
+	if !bytes.Equal(v1, v2) || !bytes.Equal(v1, expectedHash) {
+		t.Logf("ref: %v", expectedHash)
+		t.Logf("act: %v, %v", v1, v2)
+		t.Error("verifier must be deterministic")
+	}
+
+	if _, err := config.Verifier(password, nil); !errors.Is(err, ErrSaltTooShort) {
+		t.Errorf("expected ErrSaltTooShort, got: %v", err)
+	}
+}
+
+func TestPrefixMatch(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	ok, err := r.PrefixMatch(password, 4)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("prefix should match")
+	}
+
+	ok, err = r.PrefixMatch([]byte("wrong password"), 4)
+	mustBeFalsey(t, "err3", err)
+
+	if ok {
+		t.Error("prefix shouldn't match")
+	}
+
+	for _, n := range []int{0, len(r.Hash) + 1} {
+		if _, err := r.PrefixMatch(password, n); !errors.Is(err, ErrIncorrectParameter) {
+			t.Errorf("expected ErrIncorrectParameter for %d, got: %v", n, err)
+		}
+	}
+}
+
+func TestDetectConfigMutation(t *testing.T) {
+	defer func() { DetectConfigMutation = false }()
+	DetectConfigMutation = true
+
+	r, err := config.Hash(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	ok, err := r.Verify(password)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	r.Config.TimeCost++
+
+	if _, err := r.Verify(password); err != ErrConfigMutated {
+		t.Errorf("expected ErrConfigMutated, got: %v", err)
+	}
+
+	if _, err := r.PrefixMatch(password, 4); err != ErrConfigMutated {
+		t.Errorf("PrefixMatch: expected ErrConfigMutated, got: %v", err)
+	}
+
+	if _, err := r.VerifyWipe([]byte("password")); err != ErrConfigMutated {
+		t.Errorf("VerifyWipe: expected ErrConfigMutated, got: %v", err)
+	}
+
+	if _, err := VerifyRawStreaming(r, password); err != ErrConfigMutated {
+		t.Errorf("VerifyRawStreaming: expected ErrConfigMutated, got: %v", err)
+	}
+}
+
+func TestMeetsBaseline(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode = ModeArgon2id
+	cfg.MemoryCost = 19456
+	cfg.TimeCost = 2
+
+	ok, failures := cfg.MeetsBaseline(BaselineOWASP)
+	if !ok || len(failures) != 0 {
+		t.Errorf("config should meet the baseline, but: %v", failures)
+	}
+
+	ok, failures = config.MeetsBaseline(BaselineOWASP)
+	ref := []string{"mode is not Argon2id", "memory cost below 19456 KiB"}
+
+	if ok || !reflect.DeepEqual(failures, ref) {
+		t.Logf("ref: %v", ref)
+		t.Logf("act: %v", failures)
+		t.Error("config should not meet the baseline")
+	}
+
+	ok, failures = config.MeetsBaseline(BaselineNISTMin)
+	if !ok || len(failures) != 0 {
+		t.Errorf("config should meet the baseline, but: %v", failures)
+	}
+}
+
+func TestMemoryPerLane(t *testing.T) {
+	for _, c := range []struct{ kib, p, ref uint32 }{
+		{1024, 4, 4096},
+		{1 << 16, 1, 1 << 16},
+		{0, 4, 0},
+		{1 << 31, 2, MaxMemory},
+		{math.MaxUint32, math.MaxUint32, MaxMemory},
+	} {
+		if act := MemoryPerLane(c.kib, c.p); act != c.ref {
+			t.Errorf("MemoryPerLane(%d, %d): expected %d, got %d", c.kib, c.p, c.ref, act)
+		}
+	}
+}
+
+func TestHashDebug(t *testing.T) {
+	r, full, err := config.HashDebug(password, salt)
+	mustBeFalsey(t, "err", err)
+
+	if uint32(len(full)) < r.Config.HashLength || !bytes.Equal(full[:len(r.Hash)], r.Hash) {
+		t.Logf("ref: %v", r.Hash)
+		t.Logf("act: %v", full)
+		t.Error("full output should start with the hash")
+	}
+}
+
+func TestMaxPasswordLength(t *testing.T) {
+	cfg := config
+	cfg.MaxPasswordLength = uint32(len(password)) - 1
+
+	if _, err := cfg.Hash(password, salt); !errors.Is(err, ErrPwdTooLong) {
+		t.Errorf("expected ErrPwdTooLong, got: %v", err)
+	}
+
+	cfg.MaxPasswordLength = uint32(len(password))
+
+	r, err := cfg.Hash(password, salt)
+	mustBeFalsey(t, "err", err)
+
+	if !bytes.Equal(r.Hash, expectedHash) {
+		t.Logf("ref: %v", expectedHash)
+		t.Logf("act: %v", r.Hash)
+		t.Error("a password within the limit should be hashed")
+	}
+}
+
+func TestVerifyEncodedConfig(t *testing.T) {
+	ok, cfg, err := VerifyEncodedConfig(password, expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	ref := config
+	ref.SaltLength = uint32(len(salt))
+
+	if cfg == nil || *cfg != ref {
+		t.Logf("ref: %+v", ref)
+		t.Logf("act: %+v", cfg)
+		t.Error("unexpected config")
+	}
+
+	ok, cfg, err = VerifyEncodedConfig([]byte("wrong password"), expectedEncoded)
+	mustBeFalsey(t, "err2", err)
+
+	if ok || cfg == nil {
+		t.Errorf("unexpected result: %v, %v", ok, cfg)
+	}
+}
+
+func TestHashWithStats(t *testing.T) {
+	cfg := config
+	cfg.Parallelism = 4
+
+	_, stats, err := cfg.HashWithStats(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	if stats.MemoryBytes != cfg.MemoryUsageBytes() || stats.Duration <= 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// 4100 KiB aren't a multiple of 4 blocks per lane and are rounded down.
+	cfg.MemoryCost = 4100
+
+	_, stats, err = cfg.HashWithStats(password, salt)
+	mustBeFalsey(t, "err2", err)
+
+	if stats.MemoryBytes != 4096*1024 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestHashInstrumented(t *testing.T) {
+	r, timings, err := config.HashInstrumented(password, salt)
+	mustBeFalsey(t, "err", err)
+
+	if !bytes.Equal(r.Hash, expectedHash) {
+		t.Logf("ref: %v", expectedHash)
+		t.Logf("act: %v", r.Hash)
+		t.Error("hashes do not match")
+	}
+
+	if timings == nil || len(timings) != 0 {
+		t.Errorf("expected empty LaneTimings, got: %v", timings)
+	}
+}
+
+func TestRawValidate(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+	mustBeFalsey(t, "err2", r.Validate())
+
+	r.Config.HashLength++
+
+	if err := r.Validate(); err != ErrInconsistentRaw {
+		t.Errorf("expected ErrInconsistentRaw, got: %v", err)
+	}
+
+	r.Config.HashLength--
+	r.Config.Mode = 42
+
+	if err := r.Validate(); !errors.Is(err, ErrIncorrectType) {
+		t.Errorf("expected ErrIncorrectType, got: %v", err)
+	}
+}
+
+func TestVerifyRawStreaming(t *testing.T) {
+	r, err := config.HashLen(password, salt, 4096)
+	mustBeFalsey(t, "err1", err)
+
+	ok, err := VerifyRawStreaming(r, password)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	ok, err = VerifyRawStreaming(r, []byte("wrong password"))
+	mustBeFalsey(t, "err3", err)
+
+	if ok {
+		t.Error("hash shouldn't match")
+	}
+
+	// Unlike Raw.Verify() no copy of the hash is allocated on the Go heap.
+	var m1, m2 runtime.MemStats
+	runtime.ReadMemStats(&m1)
+	_, err = VerifyRawStreaming(r, password)
+	runtime.ReadMemStats(&m2)
+	mustBeFalsey(t, "err4", err)
+
+	if n := m2.TotalAlloc - m1.TotalAlloc; n >= uint64(len(r.Hash)) {
+		t.Errorf("expected less than %d bytes to be allocated, got %d", len(r.Hash), n)
+	}
+}
+
+func TestCreateCredential(t *testing.T) {
+	before := time.Now()
+
+	cred, err := CreateCredential(&config, password, false)
+	mustBeFalsey(t, "err1", err)
+
+	ok, err := VerifyEncoded(password, cred.Encoded)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	if cred.Params == nil || *cred.Params != config || cred.Params == &config {
+		t.Logf("ref: %+v", config)
+		t.Logf("act: %+v", cred.Params)
+		t.Error("Params should be a copy of the Config")
+	}
+
+	if cred.CreatedAt.Before(before) {
+		t.Errorf("unexpected CreatedAt: %v", cred.CreatedAt)
+	}
+
+	if !bytes.Equal(password, []byte("password")) {
+		t.Fatalf("pwd must not be zeroed unless requested, but is: %v", password)
+	}
+
+	pwd := append([]byte(nil), password...)
+	_, err = CreateCredential(&config, pwd, true)
+	mustBeFalsey(t, "err3", err)
+
+	if !bytes.Equal(pwd, make([]byte, len(pwd))) {
+		t.Errorf("pwd should be zeroed, but is: %v", pwd)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	cfg := config
+	f := cfg.Freeze()
+	cfg.TimeCost = 1
+
+	r, err := f.Hash(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	if !bytes.Equal(r.Hash, expectedHash) {
+		t.Logf("ref: %v", expectedHash)
+		t.Logf("act: %v", r.Hash)
+		t.Error("hashes do not match")
+	}
+
+	ok, err := f.Verify(password, salt, expectedHash)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	// Registered secrets must affect neither Hash() nor Verify().
+	defer func(r *SecretRegistry) { Secrets = r }(Secrets)
+	Secrets = &SecretRegistry{}
+	mustBeFalsey(t, "err3", Secrets.Register("k1", []byte("pepper1")))
+
+	r, err = f.Hash(password, nil)
+	mustBeFalsey(t, "err4", err)
+
+	ok, err = f.Verify(password, r.Salt, r.Hash)
+	mustBeFalsey(t, "err5", err)
+
+	if !ok {
+		t.Error("Verify must match the output of Hash")
+	}
+
+	c := f.Config()
+	c.TimeCost = 1
+
+	if f.Config() != config {
+		t.Error("FrozenConfig must not be modifiable")
+	}
+
+	typ := reflect.TypeOf(f)
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).IsExported() {
+			t.Errorf("FrozenConfig must not export %s", typ.Field(i).Name)
+		}
+	}
+}
+
+func TestMatchesProfile(t *testing.T) {
+	p := RecommendedProfile()
+	if p.ID != DefaultConfigID {
+		t.Errorf("unexpected profile ID: %s", p.ID)
+	}
+
+	cfg := DefaultConfig()
+
+	if !cfg.MatchesProfile(p) {
+		t.Error("DefaultConfig() should match the RecommendedProfile()")
+	}
+
+	cfg.MemoryCost *= 2
+
+	if cfg.MatchesProfile(p) {
+		t.Error("a modified config should not match the RecommendedProfile()")
+	}
+
+	defer func(mode Mode) { DefaultMode = mode }(DefaultMode)
+	DefaultMode = ModeArgon2id
+
+	cfg = DefaultConfig()
+
+	if !cfg.MatchesProfile(RecommendedProfile()) {
+		t.Error("RecommendedProfile() should follow DefaultMode")
+	}
+}
+
+func TestDiffRaw(t *testing.T) {
+	a, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	b, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err2", err)
+
+	if diff := DiffRaw(a, b); diff != nil {
+		t.Errorf("expected no differences, got: %v", diff)
+	}
+
+	b.Salt = []byte("pepperpepper")
+	b.Config.SaltLength = uint32(len(b.Salt))
+	b.Config.TimeCost++
+
+	ref := []string{"Config.SaltLength", "Config.TimeCost", "Salt"}
+	act := DiffRaw(a, b)
+
+	if !reflect.DeepEqual(act, ref) {
+		t.Logf("ref: %v", ref)
+		t.Logf("act: %v", act)
+		t.Error("unexpected differences")
+	}
+}
+
+// availableMemory returns the total RAM and swap in bytes according
+// to /proc/meminfo or 0 if it can't be determined.
+func availableMemory() uint64 {
+	b, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+
+	total := uint64(0)
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || (fields[0] != "MemTotal:" && fields[0] != "SwapTotal:") {
+			continue
+		}
+
+		kib, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		total += kib * 1024
+	}
+
+	return total
+}
+
+func TestMemoryAllocationErrorMapping(t *testing.T) {
+	// The message is provided by argon2 for ARGON2_MEMORY_ALLOCATION_ERROR.
+	if msg := ErrMemoryAllocation.Error(); msg != "argon2: Memory allocation error" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+
+	if ErrMemoryAllocation == ErrMemoryTooMuch {
+		t.Error("ErrMemoryAllocation must differ from ErrMemoryTooMuch")
+	}
+
+	err := wrapOp("hash", ErrMemoryAllocationError)
+	if !errors.Is(err, ErrMemoryAllocation) || errors.Is(err, ErrMemoryTooMuch) {
+		t.Errorf("unexpected mapping: %v", err)
+	}
+}
+
+func TestMemoryAllocationError(t *testing.T) {
+	cfg := config
+	cfg.MemoryCost = MaxMemory
+	cfg.TimeCost = 1
+
+	// Only Linux refuses to overcommit such an allocation by default.
+	// Elsewhere the allocation might succeed and exhaust the machine's memory.
+	b, err := os.ReadFile("/proc/sys/vm/overcommit_memory")
+	if err != nil || strings.TrimSpace(string(b)) == "1" {
+		t.Skip("memory overcommit is not known to be disabled")
+	}
+
+	// Machines with that much memory might actually satisfy the allocation.
+	if avail := availableMemory(); avail == 0 || avail >= cfg.MemoryUsageBytes() {
+		t.Skipf("cannot rule out that %d bytes can be allocated", cfg.MemoryUsageBytes())
+	}
+
+	_, err = cfg.Hash(password, salt)
+
+	if !errors.Is(err, ErrMemoryAllocation) {
+		t.Errorf("expected ErrMemoryAllocation, got: %v", err)
+	}
+}
+
+func TestSetDefaultConfig(t *testing.T) {
+	defer func() { defaultConfig = nil }()
+
+	enc, err := HashEncoded(password)
+	mustBeFalsey(t, "err1", err)
+
+	r, err := Decode(enc)
+	mustBeFalsey(t, "err2", err)
+
+	if !r.Config.MatchesProfile(RecommendedProfile()) {
+		t.Errorf("expected the DefaultConfig(), got: %+v", r.Config)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Mode = ModeArgon2id
+	cfg.TimeCost = 2
+	SetDefaultConfig(cfg)
+
+	enc, err = HashEncoded(password)
+	mustBeFalsey(t, "err3", err)
+
+	r, err = Decode(enc)
+	mustBeFalsey(t, "err4", err)
+
+	if r.Config.Mode != ModeArgon2id || r.Config.TimeCost != 2 {
+		t.Errorf("expected the new default config, got: %+v", r.Config)
+	}
+
+	ok, err := Verify(password, enc)
+	mustBeFalsey(t, "err5", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+}
+
+func TestHashWithDerivedSalt(t *testing.T) {
+	identifier := []byte("alice@example.com")
+	siteKey := []byte("site key")
+
+	r1, err := config.HashWithDerivedSalt(password, identifier, siteKey)
+	mustBeFalsey(t, "err1", err)
+
+	r2, err := config.HashWithDerivedSalt(password, identifier, siteKey)
+	mustBeFalsey(t, "err2", err)
+
+	if uint32(len(r1.Salt)) != config.SaltLength || !bytes.Equal(r1.Salt, r2.Salt) || !bytes.Equal(r1.Hash, r2.Hash) {
+		t.Logf("ref: %x, %x", r1.Salt, r1.Hash)
+		t.Logf("act: %x, %x", r2.Salt, r2.Hash)
+		t.Error("derived salts and hashes should be reproducible")
+	}
+
+	r3, err := config.HashWithDerivedSalt(password, []byte("bob@example.com"), siteKey)
+	mustBeFalsey(t, "err3", err)
+
+	if bytes.Equal(r1.Salt, r3.Salt) {
+		t.Error("different identifiers should result in different salts")
+	}
+
+	cfg := config
+	cfg.SaltLength = 33
+
+	if _, err := cfg.HashWithDerivedSalt(password, identifier, siteKey); !errors.Is(err, ErrIncorrectParameter) {
+		t.Errorf("expected ErrIncorrectParameter, got: %v", err)
+	}
+}
+
+func TestVerifyWithConfig(t *testing.T) {
+	r, err := config.HashVersion(password, nil, Version10)
+	mustBeFalsey(t, "err1", err)
+	enc := r.Encode()
+
+	if _, err := VerifyWithConfig(password, enc, &config); err != ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch, got: %v", err)
+	}
+
+	cfg := config
+	cfg.Version = Version10
+
+	ok, err := VerifyWithConfig(password, enc, &cfg)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	ref := "echo -n password | argon2 'saltsalt' -i -t 3 -m 12 -p 1 -l 32 -v 13"
+	act := config.CommandLine(salt)
+
+	if act != ref {
+		t.Logf("ref: %s", ref)
+		t.Logf("act: %s", act)
+		t.Error("command lines do not match")
+	}
+
+	cfg := config
+	cfg.Mode = ModeArgon2id
+	cfg.MemoryCost = 19456
+	cfg.Version = Version10
+
+	ref = "echo -n password | argon2 'it'\\''s' -id -t 3 -k 19456 -p 1 -l 32 -v 10"
+	act = cfg.CommandLine([]byte("it's"))
+
+	if act != ref {
+		t.Logf("ref: %s", ref)
+		t.Logf("act: %s", act)
+		t.Error("command lines do not match")
+	}
+}
+
+func TestWouldMatch(t *testing.T) {
+	other, err := config.HashEncoded([]byte("other password"))
+	mustBeFalsey(t, "err1", err)
+
+	okA, okB, err := WouldMatch(password, expectedEncoded, other)
+	mustBeFalsey(t, "err2", err)
+
+	if !okA || okB {
+		t.Errorf("expected (true, false), got (%v, %v)", okA, okB)
+	}
+}
+
+func TestHashContext(t *testing.T) {
+	r, err := config.HashContext(context.Background(), password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	if !bytes.Equal(r.Hash, expectedHash) {
+		t.Error("hashes do not match")
+	}
+
+	var ctx context.Context
+
+	if _, err := config.HashContext(ctx, password, salt); err != ErrNilContext {
+		t.Errorf("expected ErrNilContext, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := config.HashContext(ctx, password, salt); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestOnHash(t *testing.T) {
+	var (
+		calls   int
+		lastCfg *Config
+		lastErr error
+	)
+
+	defer func() { OnHash = nil }()
+	OnHash = func(cfg *Config, duration time.Duration, err error) {
+		calls++
+		lastCfg = cfg
+		lastErr = err
+	}
+
+	cfg := config
+
+	_, err := cfg.Hash(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	if calls != 1 || lastCfg != &cfg || lastErr != nil {
+		t.Errorf("unexpected hook invocation: %d, %p, %v", calls, lastCfg, lastErr)
+	}
+
+	_, err = cfg.Hash(password, []byte("ab"))
+	mustBeTruthy(t, "err2", err)
+
+	if calls != 2 || lastCfg != &cfg || !errors.Is(err, lastErr) {
+		t.Errorf("unexpected hook invocation: %d, %p, %v", calls, lastCfg, lastErr)
+	}
+}
+
+func TestHashSingleThreaded(t *testing.T) {
+	cfg := config
+	cfg.Parallelism = 4
+
+	r1, err := cfg.Hash(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	cfg.SingleThreaded = true
+
+	r2, err := cfg.Hash(password, salt)
+	mustBeFalsey(t, "err2", err)
+
+	if !bytes.Equal(r1.Hash, r2.Hash) {
+		t.Logf("ref: %v", r1.Hash)
+		t.Logf("act: %v", r2.Hash)
+		t.Error("hashes do not match")
+	}
+}
+
+func TestHashSaltTooShort(t *testing.T) {
+	r, err := config.Hash(password, []byte("ab"))
+	mustBeFalsey(t, "r", r)
+
+	if !errors.Is(err, ErrSaltTooShort) {
+		t.Fatalf("expected ErrSaltTooShort, got: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "8 bytes") {
+		t.Errorf("error should name the minimum salt length: %v", err)
+	}
+}
+
+func TestDecodeData(t *testing.T) {
+	encoded := []byte("$argon2i$v=19$m=4096,t=3,p=1,data=YXNzb2NpYXRlZCBkYXRh$c2FsdHNhbHQ$X099fyO4r2woGJ+FK9g/rkbHJPazKrpTgvr2LAq6MqU")
+
+	r, err := Decode(encoded)
+	mustBeFalsey(t, "err1", err)
+
+	if string(r.Data) != "associated data" {
+		t.Errorf("unexpected data: %q", r.Data)
+	}
+
+	if !bytes.Equal(r.Salt, salt) {
+		t.Errorf("unexpected salt: %q", r.Salt)
+	}
+
+	ok, err := r.Verify(password)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash with associated data should match")
+	}
+
+	if enc := r.Encode(); !bytes.Equal(enc, encoded) {
+		t.Logf("ref: %s", encoded)
+		t.Logf("act: %s", enc)
+		t.Error("encoded strings do not match")
+	}
+
+	bin, err := r.MarshalBinary()
+	mustBeFalsey(t, "err3", err)
+
+	var r2 Raw
+	err = r2.UnmarshalBinary(bin)
+	mustBeFalsey(t, "err4", err)
+
+	if !reflect.DeepEqual(r, &r2) {
+		t.Error("binary round-trip lost the associated data")
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	defer func(r *SecretRegistry) { Secrets = r }(Secrets)
+	Secrets = &SecretRegistry{}
+
+	hashEncoded := func(kid string) []byte {
+		r, err := config.HashWithSecret(password, nil, kid)
+		mustBeFalsey(t, "err1", err)
+		return r.Encode()
+	}
+
+	plain := hashEncoded("")
+
+	mustBeFalsey(t, "err2", Secrets.Register("k1", []byte("pepper1")))
+	old := hashEncoded("k1")
+
+	mustBeFalsey(t, "err3", Secrets.Register("k2", []byte("pepper2")))
+	cur := hashEncoded("k2")
+
+	if !bytes.Contains(old, []byte(",kid=k1$")) || !bytes.Contains(cur, []byte(",kid=k2$")) {
+		t.Errorf("unexpected encodings: %s, %s", old, cur)
+	}
+
+	for _, enc := range [][]byte{plain, old, cur} {
+		ok, err := VerifyEncoded(password, enc)
+		mustBeFalsey(t, "err4", err)
+
+		if !ok {
+			t.Errorf("%s should match", enc)
+		}
+	}
+
+	// Hash() must not pick up any registered secrets.
+	r, err := config.Hash(password, nil)
+	mustBeFalsey(t, "err5", err)
+
+	if r.KeyID != "" {
+		t.Errorf("Hash() used the secret %q", r.KeyID)
+	}
+
+	ok, err := VerifyHex(password, &config, r.SaltHex(), r.HashHex())
+	mustBeFalsey(t, "err6", err)
+
+	if !ok {
+		t.Error("VerifyHex failed with registered secrets")
+	}
+
+	if _, err := config.HashWithSecret(password, nil, "k3"); err != ErrUnknownKeyID {
+		t.Errorf("expected ErrUnknownKeyID, got: %v", err)
+	}
+
+	r, err = Decode(cur)
+	mustBeFalsey(t, "err7", err)
+
+	r.KeyID = "k1"
+	if ok, _ := r.Verify(password); ok {
+		t.Error("hash must not verify using a different secret")
+	}
+
+	r.KeyID = "k3"
+	if _, err := r.Verify(password); err != ErrUnknownKeyID {
+		t.Errorf("expected ErrUnknownKeyID, got: %v", err)
+	}
+}
+
+func TestEncodeVersion10(t *testing.T) {
+	cfg := config
+	cfg.Version = Version10
+
+	r, err := cfg.Hash(password, salt)
+	mustBeFalsey(t, "err", err)
+
+	enc := r.Encode()
+
+	if !bytes.HasPrefix(enc, []byte("$argon2i$v=16$m=4096,t=3,p=1$")) {
+		t.Errorf("unexpected encoding: %s", enc)
+	}
+
+	enc = EncodeLegacyNoVersion(r)
+
+	if !bytes.HasPrefix(enc, []byte("$argon2i$m=4096,t=3,p=1$")) {
+		t.Errorf("unexpected legacy encoding: %s", enc)
+	}
+}
+
+func TestNormalizeEncoded(t *testing.T) {
+	inputs := [][]byte{
+		expectedEncoded,
+		[]byte(base64.StdEncoding.EncodeToString(expectedEncoded)),
+		[]byte(base64.RawURLEncoding.EncodeToString(expectedEncoded)),
+	}
+
+	for _, in := range inputs {
+		enc, err := NormalizeEncoded(in)
+		mustBeFalsey(t, "err", err)
+
+		if !bytes.Equal(enc, expectedEncoded) {
+			t.Logf("ref: %s", expectedEncoded)
+			t.Logf("act: %s", enc)
+			t.Error("encoded strings do not match")
+		}
+	}
+
+	if _, err := NormalizeEncoded([]byte("bm90IGEgaGFzaA==")); err == nil {
+		t.Error("base64 wrapped garbage must be rejected")
+	}
+}
+
+func TestEncodeWithPrefix(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	enc := EncodeWithPrefix(r, "myapp-")
+
+	if !bytes.HasPrefix(enc, []byte("$myapp-argon2i$v=19$")) {
+		t.Errorf("unexpected encoding: %s", enc)
+	}
+
+	r2, err := DecodeWithPrefix(enc, "myapp-")
+	mustBeFalsey(t, "err2", err)
+
+	if !reflect.DeepEqual(r, r2) {
+		t.Logf("ref: %v", r)
+		t.Logf("act: %v", r2)
+		t.Error("raws do not match")
+	}
+
+	if _, err := Decode(enc); err == nil {
+		t.Error("Decode must reject custom prefixes")
+	}
+
+	if _, err := DecodeWithPrefix(enc, "other-"); err == nil {
+		t.Error("DecodeWithPrefix must reject mismatching prefixes")
+	}
+}
+
+func TestEncodePrefixed(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	stored := r.EncodePrefixed("argon2:")
+
+	if string(stored) != "argon2:"+string(expectedEncoded) {
+		t.Errorf("unexpected encoding: %s", stored)
+	}
+
+	ok, err := VerifyEncodedPrefixed(password, stored, "argon2:")
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("VerifyEncodedPrefixed failed")
+	}
+
+	if _, err := VerifyEncodedPrefixed(password, expectedEncoded, "argon2:"); err != ErrMissingPrefix {
+		t.Errorf("expected ErrMissingPrefix for a missing prefix, got %v", err)
+	}
+
+	if _, err := VerifyEncodedPrefixed(password, stored, "bcrypt:"); err != ErrMissingPrefix {
+		t.Errorf("expected ErrMissingPrefix for a mismatching prefix, got %v", err)
+	}
+}
+
+func TestDecodeFixed(t *testing.T) {
+	cfg := config
+	cfg.SaltLength = 16
+
+	r, err := cfg.Hash(password, nil)
+	mustBeFalsey(t, "err1", err)
+
+	enc := r.Encode()
+	c, salt, hash, err := DecodeFixed(enc)
+	mustBeFalsey(t, "err2", err)
+
+	if c != r.Config || !bytes.Equal(salt[:], r.Salt) || !bytes.Equal(hash[:], r.Hash) {
+		t.Logf("ref: %v", r)
+		t.Logf("act: %v %x %x", c, salt, hash)
+		t.Error("decoded values do not match")
+	}
+
+	// expectedEncoded uses an 8 byte salt.
+	if _, _, _, err := DecodeFixed(expectedEncoded); err != ErrFixedSizeMismatch {
+		t.Errorf("expected ErrFixedSizeMismatch, got %v", err)
+	}
+}
+
+func TestDeriveKeyLong(t *testing.T) {
+	cfg := config
+	cfg.HashLength = 1 << 10
+
+	key1, err := cfg.DeriveKey(password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	key2, err := cfg.DeriveKey(password, salt)
+	mustBeFalsey(t, "err2", err)
+
+	if len(key1) != 1<<10 {
+		t.Errorf("unexpected key length: %d", len(key1))
+	}
+
+	if !bytes.Equal(key1, key2) {
+		t.Error("derived keys must be deterministic")
+	}
+
+	cfg.HashLength = 1 << 12
+
+	key3, err := cfg.DeriveKey(password, salt)
+	mustBeFalsey(t, "err3", err)
+
+	if len(key3) != 1<<12 {
+		t.Errorf("unexpected key length: %d", len(key3))
+	}
+}
+
+func TestHashTo(t *testing.T) {
+	dst := make([]byte, len(expectedHash))
+
+	err := config.HashTo(dst, password, salt)
+	mustBeFalsey(t, "err1", err)
+
+	if !bytes.Equal(dst, expectedHash) {
+		t.Error("hashes do not match")
+	}
+
+	err = config.HashTo(dst, password, []byte("ab"))
+	mustBeTruthy(t, "err2", err)
+
+	if !bytes.Equal(dst, make([]byte, len(dst))) {
+		t.Error("dst must be wiped on error")
+	}
+}
+
+func TestKnownAnswer(t *testing.T) {
+	cfg := DefaultConfig()
+
+	hash, err := cfg.KnownAnswer(password, salt)
+	mustBeFalsey(t, "err", err)
+
+	if !bytes.Equal(hash, expectedHash) {
+		t.Logf("ref: %v", expectedHash)
+		t.Logf("act: %v", hash)
+		t.Error("DefaultConfig() hash has drifted from the known answer")
+	}
+}
+
+func TestDeriveKeys(t *testing.T) {
+	keys, err := config.DeriveKeys(password, salt, 32, 16, 32)
+	mustBeFalsey(t, "err1", err)
+
+	if len(keys) != 3 || len(keys[0]) != 32 || len(keys[1]) != 16 || len(keys[2]) != 32 {
+		t.Fatalf("unexpected key lengths: %v", keys)
+	}
+
+	cfg := config
+	cfg.HashLength = 80
+
+	key, err := cfg.DeriveKey(password, salt)
+	mustBeFalsey(t, "err2", err)
+
+	if !bytes.Equal(bytes.Join(keys, nil), key) {
+		t.Logf("ref: %v", key)
+		t.Logf("act: %v", keys)
+		t.Error("keys do not match")
+	}
+}
+
+func TestEncodeBatchTo(t *testing.T) {
+	raws := make([]*Raw, 3)
+
+	for i := range raws {
+		r, err := config.HashRaw(password)
+		mustBeFalsey(t, "err1", err)
+		raws[i] = r
+	}
+
+	var buf bytes.Buffer
+	err := EncodeBatchTo(&buf, raws)
+	mustBeFalsey(t, "err2", err)
+
+	sc := bufio.NewScanner(&buf)
+	n := 0
+
+	for ; sc.Scan(); n++ {
+		r, err := Decode(sc.Bytes())
+		mustBeFalsey(t, "err3", err)
+
+		if n < len(raws) && !bytes.Equal(r.Hash, raws[n].Hash) {
+			t.Errorf("hash at line %d does not match", n)
+		}
+	}
+
+	if n != len(raws) {
+		t.Errorf("expected %d lines, got %d", len(raws), n)
+	}
+
+	buf.Reset()
+	err = EncodeBatchTo(&buf, []*Raw{raws[0], nil})
+	if err == nil || !strings.Contains(err.Error(), "index 1") {
+		t.Errorf("expected an error naming index 1, got: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("nothing should be written if an entry is nil, got: %q", buf.String())
+	}
+}
+
+func TestHashCopy(t *testing.T) {
+	r, err := config.Hash(password, salt)
+	mustBeFalsey(t, "err", err)
+
+	h := r.HashCopy()
+	h[0] ^= 0xff
+
+	s := r.SaltCopy()
+	s[0] ^= 0xff
+
+	if !bytes.Equal(r.Hash, expectedHash) || !bytes.Equal(r.Salt, salt) {
+		t.Error("mutating a copy must not affect the Raw")
+	}
+}
+
+func TestSaltLooksWeak(t *testing.T) {
+	r, err := config.HashRaw(password)
+	mustBeFalsey(t, "err1", err)
+
+	if r.SaltLooksWeak() {
+		t.Error("random salt must not look weak")
+	}
+
+	r, err = config.Hash(password, make([]byte, 16))
+	mustBeFalsey(t, "err2", err)
+
+	if !r.SaltLooksWeak() {
+		t.Error("all-zero salt must look weak")
+	}
+}
+
+func TestOpError(t *testing.T) {
+	cfg := config
+	cfg.MemoryCost = 1
+
+	_, err := cfg.Hash(password, salt)
+
+	if !errors.Is(err, ErrMemoryTooLittle) {
+		t.Fatalf("expected ErrMemoryTooLittle, got: %v", err)
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "hash") || !strings.Contains(msg, "Memory cost is too small") {
+		t.Errorf("error should contain the operation and message: %v", msg)
+	}
+
+	r := &Raw{Config: cfg, Salt: salt, Hash: expectedHash}
+	_, err = r.Verify(password)
+
+	if !errors.Is(err, ErrMemoryTooLittle) || !strings.Contains(err.Error(), "verify") {
+		t.Errorf("expected a verify ErrMemoryTooLittle, got: %v", err)
+	}
+}
+
+func TestHashSaltTooLong(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("salts longer than 4 GiB require a 64-bit platform")
+	}
+
+	// The salt must be rejected before it's ever accessed, which allows
+	// us to fake its length instead of allocating more than 4 GiB.
+	var buf [16]byte
+	longSalt := unsafe.Slice(&buf[0], uint64(1)<<32)
+
+	_, err := config.Hash(password, longSalt)
+
+	if !errors.Is(err, ErrSaltTooLong) {
+		t.Fatalf("expected ErrSaltTooLong, got: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "4294967295 bytes") {
+		t.Errorf("error should name the maximum salt length: %v", err)
+	}
+}
+
+func TestHashPwdTooLong(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("passwords longer than 4 GiB require a 64-bit platform")
+	}
+
+	// See TestHashSaltTooLong.
+	var buf [16]byte
+	longPwd := unsafe.Slice(&buf[0], uint64(1)<<32)
+
+	if _, err := config.Hash(longPwd, salt); !errors.Is(err, ErrPwdTooLong) {
+		t.Errorf("expected ErrPwdTooLong, got: %v", err)
+	}
+}
+
+func TestHashParallelismTooHigh(t *testing.T) {
+	cfg := config
+	cfg.Parallelism = 1 << 24
+
+	_, err := cfg.Hash(password, salt)
+
+	if err != ErrParallelismTooHigh {
+		t.Fatalf("expected ErrParallelismTooHigh, got: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "16777215") {
+		t.Errorf("error should name the maximum parallelism: %v", err)
+	}
+}
+
+func TestVerifyRaw(t *testing.T) {
+	r, err := config.HashRaw(password)
+	mustBeTruthy(t, "r.Config", r.Config)
+	mustBeTruthy(t, "r.Salt", r.Salt)
+	mustBeTruthy(t, "r.Hash", r.Hash)
+	mustBeFalsey(t, "err1", err)
+
+	ok, err := r.Verify(password)
+	mustBeTruthy(t, "ok", ok)
+	mustBeFalsey(t, "err2", err)
+}
+
+func TestVerifyWipe(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	pwd := append([]byte(nil), password...)
+
+	ok, err := r.VerifyWipe(pwd)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("password should match")
+	}
+
+	for _, b := range pwd {
+		if b != 0 {
+			t.Fatal("pwd must only contain 0x00")
+		}
+	}
+}
+
+func TestVerifyEncoded(t *testing.T) {
+	encoded, err := config.HashEncoded(password)
+	mustBeTruthy(t, "encoded", encoded)
+	mustBeFalsey(t, "err1", err)
+
+	ok, err := VerifyEncoded(password, encoded)
+	mustBeTruthy(t, "ok", ok)
+	mustBeFalsey(t, "err2", err)
+}
+
+func TestVerifyEncodedAllowed(t *testing.T) {
+	ok, err := VerifyEncodedAllowed(password, expectedEncoded, ModeArgon2i, ModeArgon2id)
+	mustBeFalsey(t, "err1", err)
+
+	if !ok {
+		t.Error("allowed mode should match")
+	}
+
+	ok, err = VerifyEncodedAllowed(password, expectedEncoded, ModeArgon2id)
+
+	if ok || err != ErrModeNotAllowed {
+		t.Errorf("expected ErrModeNotAllowed, got: %v", err)
+	}
+}
+
+func TestInDenylist(t *testing.T) {
+	var denylist []*Raw
+
+	for _, pwd := range []string{"123456", "password", "qwerty"} {
+		r, err := config.Hash([]byte(pwd), salt)
+		mustBeFalsey(t, "err1", err)
+		denylist = append(denylist, r)
+	}
+
+	ok, err := InDenylist(password, denylist)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("denied password must be found")
+	}
+
+	ok, err = InDenylist([]byte("correct horse battery staple"), denylist)
+	mustBeFalsey(t, "err3", err)
+
+	if ok {
+		t.Error("allowed password must not be found")
+	}
+}
+
+func TestVerifyEncodedBounded(t *testing.T) {
+	policy := Policy{
+		MinTimeCost:   3,
+		MinMemoryCost: 1 << 12,
+		MaxMemoryCost: 1 << 16,
+	}
+
+	ok, err := VerifyEncodedBounded(password, expectedEncoded, policy)
+	mustBeFalsey(t, "err1", err)
+
+	if !ok {
+		t.Error("in-policy hash should match")
+	}
+
+	cfg := config
+	cfg.TimeCost = 1
+	cfg.MemoryCost = 8
+
+	r, err := cfg.Hash(password, salt)
+	mustBeFalsey(t, "err2", err)
+
+	ok, err = VerifyEncodedBounded(password, r.Encode(), policy)
+
+	if ok || err != ErrPolicyViolation {
+		t.Errorf("expected ErrPolicyViolation, got: %v", err)
+	}
+}
+
+func TestEncodedScan(t *testing.T) {
+	for _, src := range []interface{}{string(expectedEncoded), append([]byte(nil), expectedEncoded...)} {
+		var e Encoded
+
+		err := e.Scan(src)
+		mustBeFalsey(t, "err1", err)
+
+		ok, err := e.Verify(password)
+		mustBeFalsey(t, "err2", err)
+
+		if !ok {
+			t.Errorf("scanned %T should match", src)
+		}
+
+		v, err := e.Value()
+		mustBeFalsey(t, "err3", err)
+
+		if b, _ := v.([]byte); !bytes.Equal(b, expectedEncoded) {
+			t.Errorf("unexpected value: %v", v)
+		}
+	}
+
+	var e Encoded
+	if err := e.Scan(42); err == nil {
+		t.Error("scanning an int must fail")
+	}
+}
+
+func TestPoolVerify(t *testing.T) {
+	type interval struct{ start, end time.Time }
+
+	var mu sync.Mutex
+	var intervals []interval
+
+	// OnHash is invoked from within the verification and thus while the slot is held.
+	defer func() { OnHash = nil }()
+	OnHash = func(_ *Config, duration time.Duration, _ error) {
+		end := time.Now()
+		mu.Lock()
+		intervals = append(intervals, interval{end.Add(-duration), end})
+		mu.Unlock()
+	}
+
+	p := NewPool(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := p.Verify(context.Background(), password, expectedEncoded)
+			if err != nil || !ok {
+				t.Errorf("pooled verification should match, got: %v, %v", ok, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(intervals) != 2 {
+		t.Fatalf("expected 2 verifications, got %d", len(intervals))
+	}
+
+	a, b := intervals[0], intervals[1]
+	if a.start.Before(b.end) && b.start.Before(a.end) {
+		t.Errorf("verifications overlap: %v and %v", a, b)
+	}
+
+	// Keep a verification running by blocking its OnHash call,
+	// so that the next one has to wait for the free slot.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	OnHash = func(*Config, time.Duration, error) {
+		close(started)
+		<-release
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Verify(context.Background(), password, expectedEncoded)
+		done <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.Verify(ctx, password, expectedEncoded); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyConcat(t *testing.T) {
+	blob := append(append([]byte(nil), expectedHash...), salt...)
+
+	ok, err := VerifyConcat(password, &config, blob, len(expectedHash))
+	mustBeFalsey(t, "err1", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	ok, err = VerifyConcat(password, &config, blob, len(expectedHash)-1)
+	mustBeFalsey(t, "err2", err)
+
+	if ok {
+		t.Error("a wrong split must not match")
+	}
+
+	if _, err := VerifyConcat(password, &config, blob, len(blob)+1); !errors.Is(err, ErrIncorrectParameter) {
+		t.Errorf("expected ErrIncorrectParameter, got: %v", err)
+	}
+}
+
+func TestVerifyHex(t *testing.T) {
+	saltHex := hex.EncodeToString(salt)
+	hashHex := hex.EncodeToString(expectedHash)
+
+	ok, err := VerifyHex(password, &config, saltHex, hashHex)
+	mustBeFalsey(t, "err1", err)
+
+	if !ok {
+		t.Error("hex encoded hash should match")
+	}
+
+	ok, err = VerifyHex(password, &config, saltHex, "zz"+hashHex)
+	mustBeTruthy(t, "err2", err)
+
+	if ok {
+		t.Error("malformed hex must not match")
+	}
+}
+
+func TestDecodeZeroParams(t *testing.T) {
+	for _, params := range []string{"m=0,t=3,p=1", "m=4096,t=0,p=1", "m=4096,t=3,p=0"} {
+		enc := []byte("$argon2i$v=19$" + params + "$c2FsdHNhbHQ$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM")
+
+		if _, err := Decode(enc); err != ErrInvalidParams {
+			t.Errorf("%s: expected ErrInvalidParams, got: %v", params, err)
+		}
+
+		if _, err := VerifyEncoded(password, enc); err != ErrInvalidParams {
+			t.Errorf("%s: expected ErrInvalidParams, got: %v", params, err)
+		}
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	enc, err := r.EncodeChecked()
+	mustBeFalsey(t, "err2", err)
+
+	if !bytes.Equal(enc, expectedEncoded) {
+		t.Logf("ref: %s", expectedEncoded)
+		t.Logf("act: %s", enc)
+		t.Error("encoded hashes do not match")
+	}
+
+	for _, raw := range []Raw{
+		{Config: r.Config, Hash: r.Hash},
+		{Config: r.Config, Salt: r.Salt},
+		{Config: r.Config},
+	} {
+		enc := raw.Encode()
+
+		if _, err := Decode(enc); err == nil {
+			t.Errorf("%s should fail to decode", enc)
+		}
+
+		if _, err := raw.EncodeChecked(); err != ErrEncodingFail {
+			t.Errorf("expected ErrEncodingFail, got: %v", err)
+		}
+	}
+}
+
+func TestDecodeUnknownParams(t *testing.T) {
+	enc := []byte("$argon2i$v=19$m=4096,t=3,p=1,keyid=abc$c2FsdHNhbHQ$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM")
+
+	r, err := Decode(enc)
+	mustBeFalsey(t, "err1", err)
+
+	ok, err := r.Verify(password)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	if _, err := DecodeStrict(enc); !errors.Is(err, ErrDecodingFail) {
+		t.Errorf("expected ErrDecodingFail, got: %v", err)
+	}
+
+	_, err = DecodeStrict(expectedEncoded)
+	mustBeFalsey(t, "err3", err)
+}
+
+func TestRedacted(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err", err)
+
+	ref := "$argon2i$v=19$m=4096,t=3,p=1$<8 bytes hidden>$<32 bytes hidden>"
+	act := r.Redacted()
+
+	if act != ref {
+		t.Logf("ref: %s", ref)
+		t.Logf("act: %s", act)
+		t.Error("redacted hashes do not match")
+	}
+}
+
+func TestColonHex(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	enc := EncodeColonHex(r)
+	ref := "73616c7473616c74:" + hex.EncodeToString(expectedHash)
+
+	if enc != ref {
+		t.Logf("ref: %s", ref)
+		t.Logf("act: %s", enc)
+		t.Error("encoded hashes do not match")
+	}
+
+	r2, err := DecodeColonHex(enc, &config)
+	mustBeFalsey(t, "err2", err)
+
+	if !reflect.DeepEqual(r, r2) {
+		t.Logf("ref: %v", r)
+		t.Logf("act: %v", r2)
+		t.Error("raws do not match")
+	}
+
+	for _, s := range []string{"", "73616c7473616c74", "zz:00", "73616c7473616c74:"} {
+		if _, err := DecodeColonHex(s, &config); !errors.Is(err, ErrDecodingFail) {
+			t.Errorf("%q: expected ErrDecodingFail, got: %v", s, err)
+		}
+	}
+}
+
+func TestDecodeInvalidAlphabet(t *testing.T) {
+	for _, enc := range []string{
+		"$argon2i$v=19$m=4096,t=3,p=1$c2Fs-HNh_HQ$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM",
+		"$argon2i$v=19$m=4096,t=3,p=1$c2FsdHNhbHQ$llvUdqp69y2RB629dCuG42kR5y-Occ_ziKV5kn3rSOM",
+	} {
+		if _, err := Decode([]byte(enc)); err != ErrInvalidAlphabet {
+			t.Errorf("%s: expected ErrInvalidAlphabet, got: %v", enc, err)
+		}
+	}
+
+	_, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err", err)
+}
+
+func TestValidateBatch(t *testing.T) {
+	encodeds := [][]byte{
+		expectedEncoded,
+		[]byte("$argon2i$v=19$m=4096,t=0,p=1$c2FsdHNhbHQ$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM"),
+		[]byte("$scrypt$ln=16,r=8,p=1$c2FsdHNhbHQ$aGFzaA"),
+		expectedEncoded,
+		[]byte("$argon2i$v=19$m=4096,t=3,p=1$c2Fs-HNh_HQ$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM"),
+	}
+
+	ref := []error{nil, ErrInvalidParams, ErrIncorrectType, nil, ErrInvalidAlphabet}
+	act := ValidateBatch(encodeds, 2)
+
+	if len(act) != len(ref) {
+		t.Fatalf("expected %d errors, got %d", len(ref), len(act))
+	}
+
+	for i := range ref {
+		if !errors.Is(act[i], ref[i]) || (ref[i] == nil) != (act[i] == nil) {
+			t.Errorf("index %d: expected %v, got %v", i, ref[i], act[i])
+		}
+	}
+}
+
+func TestIsCanonical(t *testing.T) {
+	if !IsCanonical(expectedEncoded) {
+		t.Error("expectedEncoded should be canonical")
+	}
+
+	for _, enc := range []string{
+		"$argon2i$v=19$m=4096,t=3,p=1$c2FsdHNhbHQ=$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM=",
+		"$argon2i$v=19$m=04096,t=3,p=1$c2FsdHNhbHQ$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM",
+		"$argon2i$v=19$m=4096,t=3,p=1,foo=bar$c2FsdHNhbHQ$llvUdqp69y2RB629dCuG42kR5y+Occ/ziKV5kn3rSOM",
+	} {
+		if IsCanonical([]byte(enc)) {
+			t.Errorf("%s should not be canonical", enc)
+		}
+	}
+}
+
+func TestParseShadowEntry(t *testing.T) {
+	ref, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	for _, entry := range []string{
+		string(expectedEncoded),
+		"alice:" + string(expectedEncoded) + ":19000:0:99999:7:::",
+		"alice:!" + string(expectedEncoded) + ":19000:0:99999:7:::\n",
+	} {
+		r, err := ParseShadowEntry(entry)
+		mustBeFalsey(t, "err2", err)
+
+		if !reflect.DeepEqual(ref, r) {
+			t.Logf("ref: %v", ref)
+			t.Logf("act: %v", r)
+			t.Errorf("unexpected result for %q", entry)
+		}
+	}
+
+	for _, entry := range []string{
+		"bob:$6$rounds=5000$saltsalt$hash:19000:0:99999:7:::",
+		"daemon:*:19000:0:99999:7:::",
+		"",
+	} {
+		if _, err := ParseShadowEntry(entry); err != ErrNotArgon2 {
+			t.Errorf("expected ErrNotArgon2 for %q, got: %v", entry, err)
+		}
+	}
+}
+
+func TestHashString(t *testing.T) {
+	enc, err := config.HashString(string(password))
+	mustBeFalsey(t, "err1", err)
+
+	act, err := Decode(enc)
+	mustBeFalsey(t, "err2", err)
+
+	ref, err := config.Hash(password, act.Salt)
+	mustBeFalsey(t, "err3", err)
+
+	if !bytes.Equal(act.Hash, ref.Hash) {
+		t.Logf("ref: %v", ref.Hash)
+		t.Logf("act: %v", act.Hash)
+		t.Error("HashString should match the []byte path")
+	}
+
+	_, err = config.HashString("")
+	mustBeFalsey(t, "err4", err)
+}
+
+func TestHashAndWipe(t *testing.T) {
+	pwd := append([]byte(nil), password...)
+
+	enc, err := config.HashAndWipe(pwd)
+	mustBeFalsey(t, "err1", err)
+
+	if !bytes.Equal(pwd, make([]byte, len(pwd))) {
+		t.Errorf("pwd should be zeroed, but is: %v", pwd)
+	}
+
+	ok, err := VerifyEncoded(password, enc)
+	mustBeFalsey(t, "err2", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	cfg := config
+	cfg.Mode = ModeArgon2d
+	pwd = append(pwd[:0], password...)
+
+	if _, err := cfg.HashAndWipe(pwd); err != ErrUnsafeModeForPasswords {
+		t.Errorf("expected ErrUnsafeModeForPasswords, got: %v", err)
+	}
+
+	if !bytes.Equal(pwd, make([]byte, len(pwd))) {
+		t.Errorf("pwd should be zeroed on error, but is: %v", pwd)
+	}
+}
+
+func TestHashEncodedNoVersion(t *testing.T) {
+	enc, err := config.HashEncodedNoVersion(password)
+	mustBeFalsey(t, "err1", err)
+
+	if bytes.Contains(enc, []byte("v=")) {
+		t.Errorf("unexpected version segment in %s", enc)
+	}
+
+	if _, err := Decode(enc); err == nil {
+		t.Error("Decode should require a version segment")
+	}
+
+	r, err := DecodeLegacy(enc)
+	mustBeFalsey(t, "err2", err)
+
+	if r.Config.Version != Version10 {
+		t.Errorf("expected Version10, got %v", r.Config.Version)
+	}
+
+	ok, err := r.Verify(password)
+	mustBeFalsey(t, "err3", err)
+
+	if !ok {
+		t.Error("hash should match")
+	}
+
+	r, err = DecodeLegacy(expectedEncoded)
+	mustBeFalsey(t, "err4", err)
+
+	if r.Config.Version != Version13 {
+		t.Errorf("expected Version13, got %v", r.Config.Version)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	r, err := Decode(expectedEncoded)
+	mustBeFalsey(t, "err1", err)
+
+	data, err := r.MarshalBinary()
+	mustBeFalsey(t, "err2", err)
+
+	var r2 Raw
+	err = r2.UnmarshalBinary(data)
+	mustBeFalsey(t, "err3", err)
+
+	if !reflect.DeepEqual(r, &r2) {
+		t.Logf("ref: %v", r)
+		t.Logf("act: %v", &r2)
+		t.Error("raws do not match")
+	}
+
+	data[len(data)/2] ^= 0xff
+
+	if err := r2.UnmarshalBinary(data); err != ErrCorruptData {
+		t.Errorf("expected ErrCorruptData, got: %v", err)
+	}
+}
+
+func TestMarshalBinaryGolden(t *testing.T) {
+	// All integers are little-endian, independent of the host byte order.
+	golden := []byte{
+		0x01,                   // flags: checksum
+		0x01, 0x00, 0x00, 0x00, // Mode: Argon2i
+		0x13, 0x00, 0x00, 0x00, // Version: 0x13
+		0x00, 0x10, 0x00, 0x00, // MemoryCost: 4096
+		0x03, 0x00, 0x00, 0x00, // TimeCost: 3
+		0x01, 0x00, 0x00, 0x00, // Parallelism: 1
+		0x08, 0x00, 0x00, 0x00, // len(Salt)
+		's', 'a', 'l', 't', 's', 'a', 'l', 't',
+		0x04, 0x00, 0x00, 0x00, // len(Hash)
+		0xde, 0xad, 0xbe, 0xef,
+		0xdd, 0x2d, 0xa7, 0xf0, // CRC32
+	}
+
+	ref := &Raw{
+		Config: Config{
+			HashLength:  4,
+			SaltLength:  8,
+			TimeCost:    3,
+			MemoryCost:  4096,
+			Parallelism: 1,
+			Mode:        ModeArgon2i,
+			Version:     Version13,
+		},
+		Salt: []byte("saltsalt"),
+		Hash: []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+
+	var act Raw
+	err := act.UnmarshalBinary(golden)
+	mustBeFalsey(t, "err1", err)
+
+	if !reflect.DeepEqual(ref, &act) {
+		t.Logf("ref: %v", ref)
+		t.Logf("act: %v", &act)
+		t.Error("raws do not match")
+	}
+
+	data, err := ref.MarshalBinary()
+	mustBeFalsey(t, "err2", err)
+
+	if !bytes.Equal(data, golden) {
+		t.Logf("ref: %x", golden)
+		t.Logf("act: %x", data)
+		t.Error("binary representation does not match")
+	}
+}
+
+func TestHashStream(t *testing.T) {
+	pwds := [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}
+	in := make(chan []byte, len(pwds))
+
+	for _, pwd := range pwds {
+		in <- append([]byte(nil), pwd...)
+	}
+	close(in)
+
+	var buf bytes.Buffer
+	err := HashStream(&config, in, &buf)
+	mustBeFalsey(t, "err1", err)
+
+	dec := json.NewDecoder(&buf)
+
+	for i, pwd := range pwds {
+		var rec struct {
+			Salt    []byte `json:"salt"`
+			Hash    []byte `json:"hash"`
+			Encoded string `json:"encoded"`
+		}
+
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+
+		ok, err := VerifyEncoded(pwd, []byte(rec.Encoded))
+		mustBeFalsey(t, "err2", err)
+
+		if !ok {
+			t.Errorf("record %d does not verify", i)
+		}
+	}
+
+	if dec.More() {
+		t.Error("expected exactly 3 records")
+	}
+}
+
+func TestSecureZeroMemory(t *testing.T) {
+	pwd := append([]byte(nil), password...)
+
+	// SecureZeroMemory should erase up to cap(pwd) --> let's test that too
+	SecureZeroMemory(pwd[0:0])
+
+	for _, b := range pwd {
+		if b != 0 {
+			t.Error("pwd must only contain 0x00")
+		}
+	}
+}
+
+func TestBenchmarkConfig(t *testing.T) {
+	ref := Config{
+		HashLength:  32,
+		SaltLength:  16,
+		TimeCost:    3,
+		MemoryCost:  4096,
+		Parallelism: 1,
+		Mode:        ModeArgon2i,
+		Version:     Version13,
+	}
+
+	defer func(mode Mode) { DefaultMode = mode }(DefaultMode)
+	DefaultMode = ModeArgon2id
+
+	if act := BenchmarkConfig(); act != ref {
+		t.Logf("ref: %+v", ref)
+		t.Logf("act: %+v", act)
+		t.Error("BenchmarkConfig changed")
+	}
+}
+
+func TestBenchmarkAllModes(t *testing.T) {
+	res := BenchmarkAllModes(config, 1)
+
+	for _, mode := range SupportedModes() {
+		if d, ok := res[mode]; !ok || d <= 0 {
+			t.Errorf("%s: expected a positive duration, got: %v", mode, d)
+		}
+	}
+}
+
+func TestHarden(t *testing.T) {
+	const minDuration = 20 * time.Millisecond
+
+	cfg := config
+	cfg.MemoryCost = 1 << 10
+
+	h, err := cfg.Harden(minDuration)
+	mustBeFalsey(t, "err1", err)
+
+	// The initial config takes about 1ms, so the TimeCost must have been increased.
+	if h.TimeCost <= cfg.TimeCost || h.MemoryCost != cfg.MemoryCost {
+		t.Errorf("unexpected hardened config: %+v", h)
+	}
+
+	// The fastest of a few runs is used, since the measurement is subject to noise.
+	// Harden() might settle on a TimeCost barely reaching minDuration, which is
+	// why re-measuring it can fall slightly short. A 25% tolerance accounts for that.
+	d := time.Duration(math.MaxInt64)
+	for i := 0; i < 3; i++ {
+		m, err := h.measure()
+		mustBeFalsey(t, "err2", err)
+
+		if m < d {
+			d = m
+		}
+	}
+
+	if d < minDuration*3/4 {
+		t.Errorf("hardened config takes %v, expected at least %v", d, minDuration)
+	}
+}
+
+func TestConfigForLatencySLO(t *testing.T) {
+	const p99 = 20 * time.Millisecond
+
+	cfg, err := ConfigForLatencySLO(p99, 1<<20, ModeArgon2id)
+	mustBeFalsey(t, "err1", err)
+
+	if cfg.Mode != ModeArgon2id || cfg.MemoryCost > 1<<10 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	// The fastest of a few runs is used, since the measurement is subject to noise.
+	d := time.Duration(math.MaxInt64)
+	for i := 0; i < 3; i++ {
+		m, err := cfg.measure()
+		mustBeFalsey(t, "err2", err)
+
+		if m < d {
+			d = m
+		}
+	}
+
+	if d > p99 {
+		t.Errorf("config takes %v, expected at most %v", d, p99)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	rate, err := Throughput(&config, 20*time.Millisecond)
+	mustBeFalsey(t, "err", err)
+
+	if rate <= 0 {
+		t.Errorf("expected a positive rate, got %v", rate)
+	}
+}
+
+func TestCalibrateAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "argon2.json")
+
+	cfg, err := CalibrateAndSave(path, 5*time.Millisecond, 1<<10)
+	mustBeFalsey(t, "err1", err)
+
+	if cfg.MemoryCost > 1<<10 || cfg.TimeCost == 0 {
+		t.Errorf("unexpected config: %v", cfg)
+	}
+
+	loaded, err := LoadConfig(path)
+	mustBeFalsey(t, "err2", err)
+
+	if loaded != cfg {
+		t.Logf("ref: %v", cfg)
+		t.Logf("act: %v", loaded)
+		t.Error("configs do not match")
+	}
+}
+
+func TestConfigFromBcryptCost(t *testing.T) {
+	lo, err := ConfigFromBcryptCost(4, 1<<20)
+	mustBeFalsey(t, "err1", err)
+
+	hi, err := ConfigFromBcryptCost(8, 1<<20)
+	mustBeFalsey(t, "err2", err)
+
+	if lo.Mode != ModeArgon2id || hi.Mode != ModeArgon2id {
+		t.Errorf("expected Argon2id configs: %v, %v", lo, hi)
+	}
+
+	if uint64(hi.TimeCost)*uint64(hi.MemoryCost) <= uint64(lo.TimeCost)*uint64(lo.MemoryCost) {
+		t.Errorf("higher bcrypt costs must yield more expensive configs: %v, %v", lo, hi)
+	}
+
+	if _, err := ConfigFromBcryptCost(3, 0); err == nil {
+		t.Error("bcrypt costs below 4 must be rejected")
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	cfg := BenchmarkConfig()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = cfg.Hash(password, salt)
+	}
+}
+
+func BenchmarkModes(b *testing.B) {
+	for _, mode := range SupportedModes() {
+		b.Run(mode.String(), func(b *testing.B) {
+			cfg := BenchmarkConfig()
+			cfg.Mode = mode
+
+			for i := 0; i < b.N; i++ {
+				_, _ = cfg.Hash(password, salt)
+			}
+		})
+	}
+}
+
+func BenchmarkHashAllocs(b *testing.B) {
+	cfg := BenchmarkConfig()
+
+	b.Run("Hash", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = cfg.Hash(password, salt)
+		}
+	})
+
+	b.Run("DeriveKey", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = cfg.DeriveKey(password, salt)
+		}
+	})
+
+	b.Run("HashTo", func(b *testing.B) {
+		dst := make([]byte, cfg.HashLength)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = cfg.HashTo(dst, password, salt)
+		}
+	})
+}
+
+func BenchmarkVerify(b *testing.B) {
+	cfg := BenchmarkConfig()
+	r, err := cfg.Hash(password, salt)
+	if err != nil {
+		b.Error(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = r.Verify(password)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	cfg := BenchmarkConfig()
+	r, err := cfg.Hash(password, salt)
+	if err != nil {
+		b.Error(err)
+	}
+
+	b.SetBytes(int64(len(expectedEncoded)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = r.Encode()
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	b.SetBytes(int64(len(expectedEncoded)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = Decode(expectedEncoded)
+	}
+}
+
+func BenchmarkDecodeFixed(b *testing.B) {
+	cfg := BenchmarkConfig()
+	r, err := cfg.Hash(password, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	enc := r.Encode()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _, _, _ = DecodeFixed(enc)
 	}
 }
 
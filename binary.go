@@ -0,0 +1,175 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// The binary representation of a Raw struct is laid out as follows,
+// with all integers being stored as little-endian uint32 values:
+//
+//	flags (1 byte)
+//	Mode, Version, MemoryCost, TimeCost, Parallelism
+//	len(Salt), Salt
+//	len(Hash), Hash
+//	len(Data), Data (only if binaryFlagData is set)
+//	len(KeyID), KeyID (only if binaryFlagKeyID is set)
+//	CRC32 (IEEE) of all preceding bytes (only if binaryFlagChecksum is set)
+const (
+	binaryFlagChecksum = 1 << 0
+	binaryFlagData     = 1 << 1
+	binaryFlagKeyID    = 1 << 2
+
+	binaryHeaderLen = 1 + 5*4
+)
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+//
+// The result is a compact binary representation of the Raw struct,
+// which includes a CRC32 trailer allowing UnmarshalBinary to detect corruption.
+func (raw *Raw) MarshalBinary() ([]byte, error) {
+	c := raw.Config
+	saltLen := len(raw.Salt)
+	hash := raw.unpaddedHash()
+	hashLen := len(hash)
+	dataLen := len(raw.Data)
+	kidLen := len(raw.KeyID)
+	n := binaryHeaderLen + 4 + saltLen + 4 + hashLen
+	flags := byte(binaryFlagChecksum)
+
+	if dataLen > 0 {
+		n += 4 + dataLen
+		flags |= binaryFlagData
+	}
+
+	if kidLen > 0 {
+		n += 4 + kidLen
+		flags |= binaryFlagKeyID
+	}
+
+	buf := make([]byte, n+4)
+	buf[0] = flags
+
+	off := 1
+	for _, v := range [...]uint32{uint32(c.Mode), uint32(c.Version), c.MemoryCost, c.TimeCost, c.Parallelism} {
+		binary.LittleEndian.PutUint32(buf[off:], v)
+		off += 4
+	}
+
+	binary.LittleEndian.PutUint32(buf[off:], uint32(saltLen))
+	off += 4
+	off += copy(buf[off:], raw.Salt)
+
+	binary.LittleEndian.PutUint32(buf[off:], uint32(hashLen))
+	off += 4
+	off += copy(buf[off:], hash)
+
+	if dataLen > 0 {
+		binary.LittleEndian.PutUint32(buf[off:], uint32(dataLen))
+		off += 4
+		off += copy(buf[off:], raw.Data)
+	}
+
+	if kidLen > 0 {
+		binary.LittleEndian.PutUint32(buf[off:], uint32(kidLen))
+		off += 4
+		off += copy(buf[off:], raw.KeyID)
+	}
+
+	binary.LittleEndian.PutUint32(buf[off:], crc32.ChecksumIEEE(buf[:off]))
+	return buf, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+//
+// ErrCorruptData is returned if the data contains a checksum which does not
+// match its contents, and ErrDecodingFail if the data is malformed otherwise.
+func (raw *Raw) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryHeaderLen {
+		return ErrDecodingFail
+	}
+
+	flags := data[0]
+	if flags&^(binaryFlagChecksum|binaryFlagData|binaryFlagKeyID) != 0 {
+		return ErrDecodingFail
+	}
+
+	if flags&binaryFlagChecksum != 0 {
+		n := len(data) - 4
+		if n < binaryHeaderLen {
+			return ErrDecodingFail
+		}
+		if crc32.ChecksumIEEE(data[:n]) != binary.LittleEndian.Uint32(data[n:]) {
+			return ErrCorruptData
+		}
+		data = data[:n]
+	}
+
+	var hdr [5]uint32
+	off := 1
+	for i := range hdr {
+		hdr[i] = binary.LittleEndian.Uint32(data[off:])
+		off += 4
+	}
+
+	salt, off := readBinarySlice(data, off)
+	hash, off := readBinarySlice(data, off)
+
+	var ad []byte
+	if flags&binaryFlagData != 0 {
+		ad, off = readBinarySlice(data, off)
+		if ad == nil {
+			return ErrDecodingFail
+		}
+	}
+
+	var kid []byte
+	if flags&binaryFlagKeyID != 0 {
+		kid, off = readBinarySlice(data, off)
+		if kid == nil {
+			return ErrDecodingFail
+		}
+	}
+
+	if salt == nil || hash == nil || off != len(data) {
+		return ErrDecodingFail
+	}
+
+	*raw = Raw{
+		Config: Config{
+			HashLength:  uint32(len(hash)),
+			SaltLength:  uint32(len(salt)),
+			MemoryCost:  hdr[2],
+			TimeCost:    hdr[3],
+			Parallelism: hdr[4],
+			Mode:        Mode(hdr[0]),
+			Version:     Version(hdr[1]),
+		},
+		Salt:  salt,
+		Hash:  hash,
+		Data:  ad,
+		KeyID: string(kid),
+	}
+	return nil
+}
+
+// Reads a length-prefixed byte slice starting at data[off:] and returns
+// a copy of it, as well as the offset right after it. Returns nil on failure.
+func readBinarySlice(data []byte, off int) ([]byte, int) {
+	if off < 0 || len(data)-off < 4 {
+		return nil, -1
+	}
+
+	l := int(binary.LittleEndian.Uint32(data[off:]))
+	off += 4
+
+	if l < 0 || len(data)-off < l {
+		return nil, -1
+	}
+
+	return append([]byte{}, data[off:off+l]...), off + l
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+/*
+#include "argon2.h"
+
+// Mirrors the implementation selection in ref_opt.c and blamka-round-opt.h.
+static const char* bindings_argon2_simd() {
+#if defined(__AVX512F__)
+	return "avx512f";
+#elif defined(__AVX2__)
+	return "avx2";
+#elif defined(__XOP__)
+	return "xop";
+#elif defined(__SSSE3__)
+	return "ssse3";
+#elif defined(__SSE__)
+	return "sse2";
+#else
+	return "none";
+#endif
+}
+
+static int bindings_argon2_threads() {
+#if defined(ARGON2_NO_THREADS)
+	return 0;
+#else
+	return 1;
+#endif
+}
+*/
+import "C"
+
+import "strconv"
+
+// BuildInfo returns information about how argon2 was compiled,
+// which is useful to include in bug reports. It contains the keys:
+//
+//   - "version": the default argon2 version (e.g. "13")
+//   - "threads": "true" unless compiled with ARGON2_NO_THREADS
+//   - "simd": the SIMD instruction set in use (e.g. "sse2", "avx2" or "none")
+//   - "flags": the default argon2 context flags
+func BuildInfo() map[string]string {
+	return map[string]string{
+		"version": Version(C.ARGON2_VERSION_NUMBER).String(),
+		"threads": strconv.FormatBool(C.bindings_argon2_threads() != 0),
+		"simd":    C.GoString(C.bindings_argon2_simd()),
+		"flags":   strconv.FormatUint(uint64(C.ARGON2_DEFAULT_FLAGS), 10),
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import "time"
+
+// Credential contains everything to store for a newly set password.
+// See CreateCredential.
+type Credential struct {
+	// Encoded is the encoded hash of the password. See Raw.Encode().
+	Encoded []byte
+
+	// CreatedAt is the time at which the Credential was created.
+	CreatedAt time.Time
+
+	// Params is a copy of the Config the hash was created with.
+	Params *Config
+}
+
+// CreateCredential hashes `pwd` using `cfg` and a generated salt and returns
+// the resulting Credential. Like HashEncoded() it returns ErrUnsafeModeForPasswords
+// for ModeArgon2d, unless Config.AllowArgon2dForPasswords is set.
+//
+// If `wipe` is true `pwd` is cleared using SecureZeroMemory() afterwards,
+// even if an error occurred. See Config.HashAndWipe().
+func CreateCredential(cfg *Config, pwd []byte, wipe bool) (Credential, error) {
+	if wipe {
+		defer SecureZeroMemory(pwd)
+	}
+
+	enc, err := cfg.HashEncoded(pwd)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	params := *cfg.withDefaultParallelism()
+
+	return Credential{
+		Encoded:   enc,
+		CreatedAt: time.Now(),
+		Params:    &params,
+	}, nil
+}
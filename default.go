@@ -0,0 +1,46 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import "sync"
+
+var (
+	defaultMu     sync.RWMutex
+	defaultConfig *Config
+)
+
+// SetDefaultConfig sets the Config used by the package-level
+// HashEncoded() function, which is DefaultConfig() otherwise.
+//
+// It's safe for concurrent use, but should only be called during initialization.
+func SetDefaultConfig(cfg Config) {
+	defaultMu.Lock()
+	defaultConfig = &cfg
+	defaultMu.Unlock()
+}
+
+// getDefaultConfig returns a copy of the Config set by SetDefaultConfig().
+func getDefaultConfig() Config {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	if defaultConfig == nil {
+		return DefaultConfig()
+	}
+	return *defaultConfig
+}
+
+// HashEncoded works like Config.HashEncoded(), using the Config
+// set by SetDefaultConfig() or DefaultConfig() otherwise.
+func HashEncoded(pwd []byte) ([]byte, error) {
+	cfg := getDefaultConfig()
+	return cfg.HashEncoded(pwd)
+}
+
+// Verify is a shorthand for VerifyEncoded(). Since the encoded hash
+// contains its parameters, it works independent of SetDefaultConfig().
+func Verify(pwd []byte, encoded []byte) (bool, error) {
+	return VerifyEncoded(pwd, encoded)
+}
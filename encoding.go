@@ -5,9 +5,16 @@
 package argon2
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 // A helper for Decode(). Every operation below increases the off(set).
@@ -67,6 +74,30 @@ func (p *parser) parseUint32() uint32 {
 	return r
 }
 
+// Reads a single ",key=value" parameter, stopping before the next ',' or '$'.
+// Returns false without skipping anything if the next byte isn't a ','.
+func (p *parser) readParam() (key []byte, value []byte, ok bool) {
+	if p.off >= len(p.buf) || p.buf[p.off] != ',' {
+		return nil, nil, false
+	}
+
+	i := p.off + 1
+	j := i
+
+	for j < len(p.buf) && p.buf[j] != ',' && p.buf[j] != '$' {
+		j++
+	}
+
+	p.off = j
+	seg := p.buf[i:j]
+
+	if k := bytes.IndexByte(seg, '='); k >= 0 {
+		return seg[:k], seg[k+1:], true
+	}
+
+	return seg, nil, true
+}
+
 // Skips 0 or more bytes until delim is found (the skip includes delim).
 func (p *parser) skipUntil(delim byte) {
 	i := p.off
@@ -144,18 +175,61 @@ var (
 	decChunk3 = []byte("$m=")
 	decChunk4 = []byte(",t=")
 	decChunk5 = []byte(",p=")
-	encTypD   = []byte("d$v=")
-	encTypI   = []byte("i$v=")
-	encTypID  = []byte("id$v=")
+	decChunk6 = []byte(",data=")
+	decChunk7 = []byte(",kid=")
+	encChunkV = []byte("$v=")
+	encTypD   = []byte("d")
+	encTypI   = []byte("i")
+	encTypID  = []byte("id")
 )
 
 // Encode turns a Raw struct into the official stringified/encoded argon2 representation.
 //
 // The resulting byte slice can safely be turned into a string.
+// An empty Salt or Hash results in an empty segment, which Decode() rejects.
+// Use EncodeChecked() to catch this case.
 func (raw *Raw) Encode() []byte {
+	return raw.encode(true)
+}
+
+// EncodeChecked works like Encode(), but returns ErrEncodingFail
+// instead of an undecodable result if the Salt or Hash is empty.
+func (raw *Raw) EncodeChecked() ([]byte, error) {
+	if len(raw.Salt) == 0 || len(raw.Hash) == 0 {
+		return nil, ErrEncodingFail
+	}
+	return raw.encode(true), nil
+}
+
+// EncodePrefixed works like Encode(), but prepends `prefix` verbatim,
+// e.g. "argon2:" for storage systems tagging values by their type,
+// resulting in "argon2:$argon2id$v=19$...". Use VerifyEncodedPrefixed()
+// to verify the result.
+//
+// Not to be confused with EncodeWithPrefix(), which modifies the
+// algorithm label itself, resulting in "$myapp-argon2id$v=19$...".
+func (raw *Raw) EncodePrefixed(prefix string) []byte {
+	enc := raw.Encode()
+	buf := make([]byte, 0, len(prefix)+len(enc))
+	buf = append(buf, prefix...)
+	buf = append(buf, enc...)
+	return buf
+}
+
+// EncodeLegacyNoVersion works like Raw.Encode(), but omits the "$v=" segment,
+// as it was done before the introduction of Version13.
+//
+// This is only meant for legacy consumers, which do not support the version segment.
+// Those consumers will assume Version10 and thus fail to verify Version13 hashes.
+func EncodeLegacyNoVersion(raw *Raw) []byte {
+	return raw.encode(false)
+}
+
+func (raw *Raw) encode(withVersion bool) []byte {
 	c := raw.Config
+	hash := raw.unpaddedHash()
 	saltLen64 := enc64.EncodedLen(len(raw.Salt))
-	hashLen64 := enc64.EncodedLen(len(raw.Hash))
+	hashLen64 := enc64.EncodedLen(len(hash))
 
 	// 36 is a good estimate for the maximal likely static overhead, based on:
 	//     7 ("$argon2") + 2 (mode)
@@ -179,29 +253,120 @@ func (raw *Raw) Encode() []byte {
 
 	buf = append(buf, decChunk1...)
 	buf = append(buf, encTyp...)
-	buf = strconv.AppendUint(buf, uint64(c.Version), 10)
+	if withVersion {
+		buf = append(buf, encChunkV...)
+		buf = strconv.AppendUint(buf, uint64(c.Version), 10)
+	}
 	buf = append(buf, decChunk3...)
 	buf = strconv.AppendUint(buf, uint64(c.MemoryCost), 10)
 	buf = append(buf, decChunk4...)
 	buf = strconv.AppendUint(buf, uint64(c.TimeCost), 10)
 	buf = append(buf, decChunk5...)
 	buf = strconv.AppendUint(buf, uint64(c.Parallelism), 10)
+	if len(raw.Data) > 0 {
+		buf = append(buf, decChunk6...)
+		buf = appendBase64(buf, raw.Data, 0)
+	}
+	if raw.KeyID != "" {
+		buf = append(buf, decChunk7...)
+		buf = append(buf, raw.KeyID...)
+	}
 	buf = append(buf, '$')
 	buf = appendBase64(buf, raw.Salt, saltLen64)
 	buf = append(buf, '$')
-	buf = appendBase64(buf, raw.Hash, hashLen64)
+	buf = appendBase64(buf, hash, hashLen64)
 
 	return buf
 }
 
+// Redacted returns the encoded representation of the Raw struct, in which the
+// salt and hash are replaced by their lengths, for instance:
+//
+//	$argon2i$v=19$m=4096,t=3,p=1$<16 bytes hidden>$<32 bytes hidden>
+//
+// This is meant for displaying the parameters of a hash in support tools.
+func (raw *Raw) Redacted() string {
+	enc := raw.Encode()
+	i := bytes.LastIndexByte(enc, '$')
+	i = bytes.LastIndexByte(enc[:i], '$')
+
+	buf := enc[:i]
+	buf = append(buf, "$<"...)
+	buf = strconv.AppendInt(buf, int64(len(raw.Salt)), 10)
+	buf = append(buf, " bytes hidden>$<"...)
+	buf = strconv.AppendInt(buf, int64(len(raw.unpaddedHash())), 10)
+	buf = append(buf, " bytes hidden>"...)
+	return string(buf)
+}
+
+// EncodeBatchTo writes the encoded representation of each Raw in `raws`
+// to `w`, one per line. The output is buffered and flushed once at the end.
+//
+// A nil entry in `raws` aborts the export with an error naming its index.
+// This is checked upfront, in which case nothing is written to `w`.
+func EncodeBatchTo(w io.Writer, raws []*Raw) error {
+	for i, raw := range raws {
+		if raw == nil {
+			return fmt.Errorf("argon2: raw at index %d is nil", i)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for _, raw := range raws {
+		if _, err := bw.Write(raw.Encode()); err != nil {
+			return err
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
 // Decode takes a stringified/encoded argon2 hash and turns it back into a Raw struct.
 //
-// This decoder ignores "data" attributes as they are likely to be deprecated.
+// The "data" attribute generated by older versions of the reference
+// implementation is decoded into Raw.Data and used as associated data during
+// verification. Similarly the "kid" attribute is decoded into Raw.KeyID.
+// Any other unknown attributes are ignored.
+//
+// ErrInvalidParams is returned if the memory cost, time cost or parallelism is 0
+// and ErrInvalidAlphabet if the URL-safe instead of the standard base64 alphabet is used.
 func Decode(encoded []byte) (*Raw, error) {
+	return decode(encoded, false, false)
+}
+
+// DecodeLegacy works like Decode(), but additionally accepts encoded hashes
+// without a "$v=" segment, as generated by EncodeLegacyNoVersion(),
+// in which case Version10 is assumed.
+func DecodeLegacy(encoded []byte) (*Raw, error) {
+	return decode(encoded, true, false)
+}
+
+// DecodeStrict works like Decode(), but returns ErrDecodingFail
+// for any unknown attributes, instead of ignoring them.
+func DecodeStrict(encoded []byte) (*Raw, error) {
+	return decode(encoded, false, true)
+}
+
+// The still base64 encoded segments of an encoded hash, as parsed by parse().
+// They alias the input, which allows decoding them without heap allocations.
+type segments struct {
+	config Config
+	data   []byte
+	kid    []byte
+	salt   []byte
+	hash   []byte
+}
+
+func parse(encoded []byte, legacy bool, strict bool) (segments, error) {
+	var seg segments
 	pa := parser{buf: encoded}
 
 	if pa.check(decChunk1) != 0 {
-		return nil, ErrIncorrectType
+		return seg, ErrIncorrectType
 	}
 
 	typ1 := pa.readByte()
@@ -215,7 +380,7 @@ func Decode(encoded []byte) (*Raw, error) {
 			if r == '$' {
 				mode = ModeArgon2id
 			} else {
-				return nil, ErrIncorrectType
+				return seg, ErrIncorrectType
 			}
 		} else if typ2 == '$' {
 			mode = ModeArgon2i
@@ -223,23 +388,99 @@ func Decode(encoded []byte) (*Raw, error) {
 	} else if typ1 == 'd' {
 		mode = ModeArgon2d
 	} else {
-		return nil, ErrIncorrectType
+		return seg, ErrIncorrectType
+	}
+
+	var ok int
+	var v uint32
+
+	if legacy && bytes.HasPrefix(pa.buf[pa.off:], decChunk3[1:]) {
+		// Step back to include the preceding '$' in decChunk3 below.
+		pa.off--
+		v = uint32(Version10)
+	} else {
+		ok = pa.check(decChunk2)
+		v = pa.parseUint32()
 	}
 
-	ok := pa.check(decChunk2)
-	v := pa.parseUint32()
 	ok |= pa.check(decChunk3)
 	m := pa.parseUint32()
 	ok |= pa.check(decChunk4)
 	t := pa.parseUint32()
 	ok |= pa.check(decChunk5)
 	p := pa.parseUint32()
+
+	var d, kid []byte
+	for {
+		key, val, more := pa.readParam()
+		if !more {
+			break
+		}
+
+		switch string(key) {
+		case "data":
+			if len(val) == 0 {
+				return seg, ErrDecodingFail
+			}
+			d = val
+		case "kid":
+			kid = val
+		default:
+			if strict {
+				return seg, ErrDecodingFail
+			}
+		}
+	}
+
 	pa.skipUntil('$')
+
 	s := pa.readSlice('$')
 	h := pa.readRest()
 
-	if ok != 0 || v == 0 || v > 255 || m == 0 || t == 0 || p == 0 || s == nil || h == nil {
-		return nil, ErrDecodingFail
+	if ok != 0 || v == 0 || v > 255 || s == nil || h == nil {
+		return seg, ErrDecodingFail
+	}
+
+	// Reject these before they ever reach argon2, which can't handle them.
+	if m == 0 || t == 0 || p == 0 {
+		return seg, ErrInvalidParams
+	}
+
+	// The URL-safe alphabet is a common mistake, which is why it's reported separately.
+	if bytes.ContainsAny(d, "-_") || bytes.ContainsAny(s, "-_") || bytes.ContainsAny(h, "-_") {
+		return seg, ErrInvalidAlphabet
+	}
+
+	seg.config = Config{
+		MemoryCost:  m,
+		TimeCost:    t,
+		Parallelism: p,
+		Mode:        mode,
+		Version:     Version(v),
+	}
+	seg.data = d
+	seg.kid = kid
+	seg.salt = s
+	seg.hash = h
+	return seg, nil
+}
+
+func decode(encoded []byte, legacy bool, strict bool) (*Raw, error) {
+	seg, err := parse(encoded, legacy, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	d, s, h := seg.data, seg.salt, seg.hash
+
+	var data []byte
+	if d != nil {
+		data = make([]byte, enc64.DecodedLen(len(d)))
+		dl, err := enc64.Decode(data, d)
+		if err != nil {
+			return nil, ErrDecodingFail
+		}
+		data = data[0:dl]
 	}
 
 	salt := make([]byte, enc64.DecodedLen(len(s)))
@@ -251,17 +492,209 @@ func Decode(encoded []byte) (*Raw, error) {
 		return nil, ErrDecodingFail
 	}
 
+	cfg := seg.config
+	cfg.HashLength = uint32(hl)
+	cfg.SaltLength = uint32(sl)
+
 	return &Raw{
-		Config: Config{
-			HashLength:  uint32(hl),
-			SaltLength:  uint32(sl),
-			MemoryCost:  m,
-			TimeCost:    t,
-			Parallelism: p,
-			Mode:        mode,
-			Version:     Version(v),
-		},
-		Salt: salt[0:sl],
-		Hash: hash[0:hl],
+		Config: cfg,
+		Salt:   salt[0:sl],
+		Hash:   hash[0:hl],
+		Data:   data,
+		KeyID:  string(seg.kid),
 	}, nil
 }
+
+// DecodeFixed works like Decode(), but decodes into fixed-size arrays
+// without any heap allocations. It's meant for hot paths where the
+// default salt and hash lengths of 16 and 32 bytes are known in advance.
+//
+// ErrFixedSizeMismatch is returned if the encoded salt or hash has a different length.
+// Since they can't be returned, encoded hashes with a "data" or "kid" attribute
+// are rejected with ErrDecodingFail. Use Decode() for those.
+func DecodeFixed(encoded []byte) (cfg Config, salt [16]byte, hash [32]byte, err error) {
+	seg, err := parse(encoded, false, false)
+	if err != nil {
+		return cfg, salt, hash, err
+	}
+
+	if seg.data != nil || seg.kid != nil {
+		return cfg, salt, hash, ErrDecodingFail
+	}
+
+	if len(seg.salt) != enc64.EncodedLen(len(salt)) || len(seg.hash) != enc64.EncodedLen(len(hash)) {
+		return cfg, salt, hash, ErrFixedSizeMismatch
+	}
+
+	sl, se := enc64.Decode(salt[:], seg.salt)
+	hl, he := enc64.Decode(hash[:], seg.hash)
+
+	if se != nil || he != nil {
+		return Config{}, [16]byte{}, [32]byte{}, ErrDecodingFail
+	}
+
+	cfg = seg.config
+	cfg.HashLength = uint32(hl)
+	cfg.SaltLength = uint32(sl)
+	return cfg, salt, hash, nil
+}
+
+// NormalizeEncoded returns the canonical encoding of `encoded`.
+//
+// A common mistake is to accidentally base64 encode the already encoded hash
+// a second time. If `encoded` is such a base64 wrapped hash it's unwrapped once.
+// Either way the hash is decoded and then encoded again using Raw.Encode().
+func NormalizeEncoded(encoded []byte) ([]byte, error) {
+	if !bytes.HasPrefix(encoded, decChunk1) {
+		s := string(bytes.TrimSpace(encoded))
+
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(s); err == nil && bytes.HasPrefix(b, decChunk1) {
+				encoded = b
+				break
+			}
+		}
+	}
+
+	r, err := Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return r.Encode(), nil
+}
+
+// ParseShadowEntry decodes the password field of a shadow(5) entry,
+// like "$argon2id$v=19$m=65536,t=3,p=4$...". A complete entry of the form
+// "name:$argon2id$...:19000:0:99999:7:::" is accepted as well and the
+// "!" prefix of locked accounts is ignored.
+//
+// ErrNotArgon2 is returned if the field does not contain an argon2 hash,
+// as is the case for other crypt() schemes or "*" and "!" placeholders.
+func ParseShadowEntry(field string) (*Raw, error) {
+	field = strings.TrimSpace(field)
+
+	if parts := strings.Split(field, ":"); len(parts) > 1 {
+		field = parts[1]
+	}
+
+	field = strings.TrimPrefix(field, "!")
+
+	if !strings.HasPrefix(field, string(decChunk1)) {
+		return nil, ErrNotArgon2
+	}
+
+	return Decode([]byte(field))
+}
+
+// IsCanonical returns true if `encoded` is byte-identical to what Raw.Encode()
+// would produce for it, and false if it differs or fails to decode.
+func IsCanonical(encoded []byte) bool {
+	r, err := Decode(encoded)
+	return err == nil && bytes.Equal(r.Encode(), encoded)
+}
+
+// EncodeWithPrefix works like Raw.Encode(), but inserts `prefix` in front of
+// the algorithm label. For instance the prefix "myapp-" results in an encoded
+// hash starting with "$myapp-argon2id$v=19$...".
+//
+// This is NOT a standard format and only meant for interoperability with
+// proprietary systems expecting such labels. Use DecodeWithPrefix() to decode it.
+// To merely tag a standard encoded hash with a prefix use Raw.EncodePrefixed().
+func EncodeWithPrefix(raw *Raw, prefix string) []byte {
+	enc := raw.Encode()
+	buf := make([]byte, 0, len(enc)+len(prefix))
+	buf = append(buf, '$')
+	buf = append(buf, prefix...)
+	buf = append(buf, enc[1:]...)
+	return buf
+}
+
+// DecodeWithPrefix decodes an encoded hash generated by EncodeWithPrefix().
+//
+// ErrIncorrectType is returned if `encoded` does not start with the given prefix.
+func DecodeWithPrefix(encoded []byte, prefix string) (*Raw, error) {
+	l := 1 + len(prefix)
+
+	if len(encoded) < l || encoded[0] != '$' || string(encoded[1:l]) != prefix {
+		return nil, ErrIncorrectType
+	}
+
+	buf := make([]byte, 0, len(encoded)-len(prefix))
+	buf = append(buf, '$')
+	buf = append(buf, encoded[l:]...)
+	return Decode(buf)
+}
+
+// EncodeColonHex encodes the salt and hash of `raw` as "saltHex:hashHex"
+// using lowercase hex. Since the parameters are not part of this format,
+// the Config has to be supplied to DecodeColonHex() separately.
+func EncodeColonHex(raw *Raw) string {
+	return raw.SaltHex() + ":" + raw.HashHex()
+}
+
+// DecodeColonHex decodes a "saltHex:hashHex" string as generated
+// by EncodeColonHex(), using `cfg` as the Config of the result.
+func DecodeColonHex(s string, cfg *Config) (*Raw, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, ErrDecodingFail
+	}
+
+	salt, se := hex.DecodeString(s[:i])
+	hash, he := hex.DecodeString(s[i+1:])
+
+	if se != nil || he != nil || len(salt) == 0 || len(hash) == 0 {
+		return nil, ErrDecodingFail
+	}
+
+	r := &Raw{
+		Config: *cfg,
+		Salt:   salt,
+		Hash:   hash,
+	}
+	r.Config.HashLength = uint32(len(hash))
+	r.Config.SaltLength = uint32(len(salt))
+	return r, nil
+}
+
+// ValidateEncoded returns an error if `encoded` fails to decode
+// or the resulting Raw is inconsistent. See Raw.Validate().
+// It's cheap, since it doesn't compute any hash.
+func ValidateEncoded(encoded []byte) error {
+	r, err := Decode(encoded)
+	if err != nil {
+		return err
+	}
+	return r.Validate()
+}
+
+// ValidateBatch calls ValidateEncoded() for each of the `encodeds`
+// using up to `concurrency` goroutines (GOMAXPROCS if <= 0) and returns
+// the resulting errors at the same indices. Valid entries result in nil.
+func ValidateBatch(encodeds [][]byte, concurrency int) []error {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	errs := make([]error, len(encodeds))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = ValidateEncoded(encodeds[i])
+			}
+		}()
+	}
+
+	for i := range encodeds {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return errs
+}
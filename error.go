@@ -9,13 +9,56 @@ package argon2
 */
 import "C"
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // Error represents the error code returned by argon2.
 type Error C.int
 
 func (e Error) Error() string {
-	return fmt.Sprintf("argon2: %s", C.GoString(C.argon2_error_message(C.int(e))))
+	return "argon2: " + e.message()
+}
+
+// Returns the argon2 error message, including limits where applicable.
+func (e Error) message() string {
+	msg := C.GoString(C.argon2_error_message(C.int(e)))
+
+	switch e {
+	case ErrSaltTooShort:
+		return fmt.Sprintf("%s (minimum is %d bytes)", msg, C.ARGON2_MIN_SALT_LENGTH)
+	case ErrSaltTooLong:
+		return fmt.Sprintf("%s (maximum is %d bytes)", msg, uint64(C.ARGON2_MAX_SALT_LENGTH))
+	default:
+		return msg
+	}
+}
+
+// OpError wraps an Error returned by argon2 with the operation
+// ("hash" or "verify") during which it occurred.
+//
+// Use errors.Is() to compare it against one of the Err* constants below.
+type OpError struct {
+	Op  string
+	Err Error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("argon2: %s: %s", e.Op, e.Err.message())
+}
+
+// Unwrap returns the underlying Error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Wraps `err` in an OpError for `op` if it's an Error and returns it unchanged otherwise.
+func wrapOp(op string, err error) error {
+	if e, ok := err.(Error); ok {
+		return &OpError{Op: op, Err: e}
+	}
+	return err
 }
 
 const (
@@ -55,3 +98,82 @@ const (
 	ErrDecodingLengthFail    = Error(C.ARGON2_DECODING_LENGTH_FAIL)
 	ErrVerifyMismatch        = Error(C.ARGON2_VERIFY_MISMATCH)
 )
+
+// ErrMemoryAllocation is returned if the operating system failed to
+// provide the memory argon2 requested at runtime. This is distinct from
+// ErrMemoryTooMuch, which is returned for an invalid Config.MemoryCost.
+// It's an alias for ErrMemoryAllocationError.
+const ErrMemoryAllocation = ErrMemoryAllocationError
+
+var (
+	// ErrCorruptData is returned by Raw.UnmarshalBinary if the checksum
+	// of the binary representation does not match its contents.
+	ErrCorruptData = errors.New("argon2: checksum mismatch in binary data")
+
+	// ErrPolicyViolation is returned by VerifyEncodedBounded if the
+	// parameters of an encoded hash fall outside the given Policy.
+	ErrPolicyViolation = errors.New("argon2: parameters violate the policy")
+
+	// ErrParallelismTooHigh is returned if Config.Parallelism exceeds
+	// the maximum number of lanes and threads supported by argon2.
+	ErrParallelismTooHigh = fmt.Errorf("argon2: Parallelism is too high (maximum is %d)", C.ARGON2_MAX_LANES)
+
+	// ErrCustomSaltReader is returned in builds with the "fips" build tag
+	// if a salt is to be generated, but SaltReader has been replaced.
+	ErrCustomSaltReader = errors.New("argon2: custom SaltReader is not permitted in FIPS mode")
+
+	// ErrUnsafeModeForPasswords is returned by Config.HashEncoded for ModeArgon2d,
+	// unless Config.AllowArgon2dForPasswords is set.
+	ErrUnsafeModeForPasswords = errors.New("argon2: Argon2d is unsafe for password hashing")
+
+	// ErrNilContext is returned by Config.HashContext if the context is nil.
+	ErrNilContext = errors.New("argon2: nil context")
+
+	// ErrInvalidKeyID is returned by SecretRegistry.Register if the key ID
+	// is empty or contains any of the reserved characters ",$=".
+	ErrInvalidKeyID = errors.New("argon2: invalid key ID")
+
+	// ErrUnknownKeyID is returned if a hash refers to a
+	// key ID, which has not been registered in Secrets.
+	ErrUnknownKeyID = errors.New("argon2: unknown key ID")
+
+	// ErrModeNotAllowed is returned by VerifyEncodedAllowed
+	// if the Mode of the encoded hash is not allowed.
+	ErrModeNotAllowed = errors.New("argon2: mode not allowed")
+
+	// ErrInvalidTOML is returned by ConfigFromTOML if the
+	// `[argon2]` table contains a malformed line or value.
+	ErrInvalidTOML = errors.New("argon2: invalid TOML")
+
+	// ErrNotArgon2 is returned by ParseShadowEntry
+	// if the field does not contain an argon2 hash.
+	ErrNotArgon2 = errors.New("argon2: not an argon2 hash")
+
+	// ErrConfigMutated is returned by Raw.Verify if DetectConfigMutation
+	// is set and Raw.Config has been modified after Hash() returned it.
+	ErrConfigMutated = errors.New("argon2: config was modified after hashing")
+
+	// ErrInconsistentRaw is returned by Raw.Validate if the lengths of the salt
+	// or hash don't match Config.SaltLength and Config.HashLength respectively.
+	ErrInconsistentRaw = errors.New("argon2: salt or hash length does not match the config")
+
+	// ErrInvalidParams is returned by Decode if the memory cost,
+	// time cost or parallelism of the encoded hash is 0.
+	ErrInvalidParams = errors.New("argon2: invalid parameters")
+
+	// ErrVersionMismatch is returned by VerifyWithConfig if the
+	// Version of the encoded hash differs from the given Config.
+	ErrVersionMismatch = errors.New("argon2: version mismatch")
+
+	// ErrInvalidAlphabet is returned by Decode if the encoded hash uses the
+	// URL-safe base64 alphabet instead of the standard one.
+	ErrInvalidAlphabet = errors.New("argon2: invalid base64 alphabet")
+
+	// ErrFixedSizeMismatch is returned by DecodeFixed if the encoded
+	// salt or hash is not exactly 16 or 32 bytes long respectively.
+	ErrFixedSizeMismatch = errors.New("argon2: salt or hash length does not match the fixed size")
+
+	// ErrMissingPrefix is returned by VerifyEncodedPrefixed
+	// if the stored value does not start with the given prefix.
+	ErrMissingPrefix = errors.New("argon2: missing prefix")
+)
@@ -0,0 +1,10 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build fips
+
+package argon2
+
+// fipsMode restricts salt generation to crypto/rand. See SaltReader.
+const fipsMode = true
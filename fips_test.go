@@ -0,0 +1,27 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build fips
+
+package argon2
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFIPSSaltReader(t *testing.T) {
+	_, err := config.HashRaw(password)
+	mustBeFalsey(t, "err1", err)
+
+	defer func(r io.Reader) { SaltReader = r }(SaltReader)
+	SaltReader = bytes.NewReader(make([]byte, 64))
+
+	_, err = config.HashRaw(password)
+
+	if err != ErrCustomSaltReader {
+		t.Errorf("expected ErrCustomSaltReader, got: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+// FrozenConfig is an immutable Config, which is useful for configurations
+// shared globally. It's created using Config.Freeze().
+//
+// Its parameters are stored in a private copy, which can't be modified by
+// callers. The zero value is not usable.
+type FrozenConfig struct {
+	cfg Config
+}
+
+// Freeze returns a FrozenConfig using a copy of the Config.
+// Later changes to `c` are not reflected by the FrozenConfig.
+func (c Config) Freeze() FrozenConfig {
+	return FrozenConfig{cfg: c}
+}
+
+// Config returns a copy of the frozen Config.
+func (f FrozenConfig) Config() Config {
+	return f.cfg
+}
+
+// Hash works like Config.Hash().
+func (f FrozenConfig) Hash(pwd []byte, salt []byte) (*Raw, error) {
+	return f.cfg.Hash(pwd, salt)
+}
+
+// HashEncoded works like Config.HashEncoded().
+func (f FrozenConfig) HashEncoded(pwd []byte) ([]byte, error) {
+	return f.cfg.HashEncoded(pwd)
+}
+
+// Verify returns true if `pwd` matches `hash`,
+// which was generated using the frozen Config and `salt`.
+// Like Hash() it never uses a secret from the Secrets registry.
+func (f FrozenConfig) Verify(pwd []byte, salt []byte, hash []byte) (bool, error) {
+	r := Raw{
+		Config: f.cfg,
+		Salt:   salt,
+		Hash:   hash,
+	}
+	r.Config.HashLength = uint32(len(hash))
+	r.Config.SaltLength = uint32(len(salt))
+	return r.Verify(pwd)
+}
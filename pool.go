@@ -0,0 +1,38 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import "context"
+
+// Pool bounds the number of concurrently running verifications.
+//
+// Since every verification allocates Config.MemoryCost KiB of memory,
+// this bounds the global memory usage of a service under burst load,
+// by applying backpressure instead of spawning unbounded work.
+type Pool struct {
+	sem chan struct{}
+}
+
+// NewPool returns a Pool, which runs at most `maxConcurrent`
+// verifications at a time. Values < 1 are treated as 1.
+func NewPool(maxConcurrent int) *Pool {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &Pool{sem: make(chan struct{}, maxConcurrent)}
+}
+
+// Verify works like VerifyEncoded(), but blocks until a slot in the Pool
+// is free. If `ctx` is done before that ctx.Err() is returned instead.
+func (p *Pool) Verify(ctx context.Context, pwd []byte, encoded []byte) (bool, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	return VerifyEncoded(pwd, encoded)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+/*
+#include "argon2.h"
+*/
+import "C"
+
+import "encoding/json"
+
+// JSONSchema returns a JSON Schema describing the fields of a Config as
+// serialized by encoding/json, including the ranges accepted by argon2.
+// The values of `c` are used as the defaults of the respective fields.
+//
+// This allows ops tooling to validate configurations before deployment.
+func (c *Config) JSONSchema() []byte {
+	integer := func(min, max uint64, def uint32) map[string]interface{} {
+		return map[string]interface{}{
+			"type":    "integer",
+			"minimum": min,
+			"maximum": max,
+			"default": def,
+		}
+	}
+
+	modes := []uint32{}
+	for _, m := range SupportedModes() {
+		modes = append(modes, uint32(m))
+	}
+
+	versions := []uint32{}
+	for _, v := range SupportedVersions() {
+		versions = append(versions, uint32(v))
+	}
+
+	schema := map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "argon2.Config",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"HashLength":  integer(C.ARGON2_MIN_OUTLEN, C.ARGON2_MAX_OUTLEN, c.HashLength),
+			"SaltLength":  integer(C.ARGON2_MIN_SALT_LENGTH, C.ARGON2_MAX_SALT_LENGTH, c.SaltLength),
+			"TimeCost":    integer(C.ARGON2_MIN_TIME, C.ARGON2_MAX_TIME, c.TimeCost),
+			"MemoryCost":  integer(C.ARGON2_MIN_MEMORY, uint64(MaxMemory), c.MemoryCost),
+			"Parallelism": integer(C.ARGON2_MIN_LANES, C.ARGON2_MAX_LANES, c.Parallelism),
+			"Mode": map[string]interface{}{
+				"enum":    modes,
+				"default": c.Mode,
+			},
+			"Version": map[string]interface{}{
+				"enum":    versions,
+				"default": c.Version,
+			},
+			"MaxPasswordLength": integer(0, C.ARGON2_MAX_PWD_LENGTH, c.MaxPasswordLength),
+			"SingleThreaded": map[string]interface{}{
+				"type":    "boolean",
+				"default": c.SingleThreaded,
+			},
+			"AllowArgon2dForPasswords": map[string]interface{}{
+				"type":    "boolean",
+				"default": c.AllowArgon2dForPasswords,
+			},
+		},
+		"required": []string{"HashLength", "SaltLength", "TimeCost", "MemoryCost", "Parallelism", "Mode", "Version"},
+	}
+
+	// Marshaling maps of plain values cannot fail.
+	b, _ := json.Marshal(schema)
+	return b
+}
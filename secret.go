@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import (
+	"strings"
+	"sync"
+)
+
+// SecretRegistry maps key IDs to secrets (also known as peppers),
+// which are fed into argon2 as its secret input.
+//
+// Hashes store the ID of the secret they were created with in a ",kid="
+// attribute of their encoded representation. This allows you to rotate the
+// secret you pass to Config.HashWithSecret() while still being able to
+// verify hashes using older ones.
+//
+// A SecretRegistry is safe for concurrent use. The zero value is ready to use.
+type SecretRegistry struct {
+	mu      sync.RWMutex
+	secrets map[string][]byte
+}
+
+// Secrets is the SecretRegistry used by Config.HashWithSecret() and Raw.Verify().
+// It's empty by default. Config.Hash() never uses it.
+var Secrets = &SecretRegistry{}
+
+// Register stores a copy of `secret` under the given key ID.
+//
+// ErrInvalidKeyID is returned if `kid` is empty
+// or contains any of the reserved characters ",$=".
+func (r *SecretRegistry) Register(kid string, secret []byte) error {
+	if kid == "" || strings.ContainsAny(kid, ",$=") {
+		return ErrInvalidKeyID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.secrets == nil {
+		r.secrets = make(map[string][]byte)
+	}
+	r.secrets[kid] = append([]byte(nil), secret...)
+	return nil
+}
+
+// Returns the secret for `kid`, which is nil if `kid` is empty.
+func (r *SecretRegistry) lookup(kid string) ([]byte, error) {
+	if kid == "" {
+		return nil, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	secret, ok := r.secrets[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	return secret, nil
+}
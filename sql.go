@@ -0,0 +1,45 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Encoded is an encoded argon2 hash as returned by Raw.Encode(),
+// which implements the sql.Scanner and driver.Valuer interfaces.
+// This allows it to be mapped directly to a database column.
+type Encoded []byte
+
+// Scan implements the sql.Scanner interface.
+// It accepts string and []byte values, as well as NULL.
+func (e *Encoded) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*e = nil
+	case string:
+		*e = Encoded(v)
+	case []byte:
+		// The driver may reuse the buffer after Scan returns.
+		*e = append(Encoded(nil), v...)
+	default:
+		return fmt.Errorf("argon2: cannot scan %T into Encoded", src)
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (e Encoded) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return []byte(e), nil
+}
+
+// Verify returns true if `pwd` matches the encoded hash. See VerifyEncoded().
+func (e Encoded) Verify(pwd []byte) (bool, error) {
+	return VerifyEncoded(pwd, e)
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// bcryptReferenceCost10 is the approximate duration of a bcrypt hash with a
+// cost of 10 on a typical ~3 GHz x86-64 core. Each increment of the cost doubles it.
+// It's a fixed reference value, since this package has no bcrypt implementation to measure.
+const bcryptReferenceCost10 = 65 * time.Millisecond
+
+// BenchmarkAllModes hashes a password `iterations` times for each of the
+// SupportedModes() using the cost parameters of `cfg` and returns the
+// average duration of a single hash per mode.
+//
+// Modes for which hashing fails are omitted from the result.
+func BenchmarkAllModes(cfg Config, iterations int) map[Mode]time.Duration {
+	if iterations < 1 {
+		iterations = 1
+	}
+
+	pwd := []byte("password")
+	salt := make([]byte, 16)
+	res := make(map[Mode]time.Duration)
+
+	for _, mode := range SupportedModes() {
+		cfg.Mode = mode
+		start := time.Now()
+		ok := true
+
+		for i := 0; i < iterations; i++ {
+			if _, err := cfg.Hash(pwd, salt); err != nil {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			res[mode] = time.Since(start) / time.Duration(iterations)
+		}
+	}
+
+	return res
+}
+
+// Throughput hashes a password using `cfg` repeatedly for approximately
+// `duration`, but at least once, and returns the number of hashes per second.
+// It's meant for capacity planning and uses only the calling goroutine.
+func Throughput(cfg *Config, duration time.Duration) (hashesPerSecond float64, err error) {
+	pwd := []byte("password")
+	salt := make([]byte, 16)
+	n := 0
+	start := time.Now()
+
+	for {
+		if _, err := cfg.Hash(pwd, salt); err != nil {
+			return 0, err
+		}
+		n++
+
+		if elapsed := time.Since(start); elapsed >= duration {
+			return float64(n) / elapsed.Seconds(), nil
+		}
+	}
+}
+
+// Returns the duration of a single hash using `c`.
+func (c *Config) measure() (time.Duration, error) {
+	pwd := []byte("password")
+	salt := make([]byte, 16)
+
+	start := time.Now()
+	_, err := c.Hash(pwd, salt)
+	return time.Since(start), err
+}
+
+// Calibrate returns a variant of DefaultConfig() for which a single hash takes
+// approximately `target` on the current machine, using at most `maxMem` KiB of
+// memory. A `maxMem` of 0 uses the MemoryCost of DefaultConfig() instead.
+//
+// Memory is preferred over time: MemoryCost starts at `maxMem` and is only
+// halved while a hash takes longer than `target`. Afterwards the TimeCost
+// is increased to make up for any remaining difference.
+func Calibrate(target time.Duration, maxMem uint32) (Config, error) {
+	return calibrate(DefaultConfig(), target, maxMem)
+}
+
+// calibrate implements Calibrate() starting from the given Config.
+func calibrate(cfg Config, target time.Duration, maxMem uint32) (Config, error) {
+	if maxMem != 0 {
+		cfg.MemoryCost = maxMem
+	}
+
+	d, err := cfg.measure()
+	if err != nil {
+		return Config{}, err
+	}
+
+	for d > target && cfg.MemoryCost/2 >= 8*cfg.Parallelism {
+		cfg.MemoryCost /= 2
+
+		if d, err = cfg.measure(); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if d > 0 && d < target {
+		t := uint64(target) * uint64(cfg.TimeCost) / uint64(d)
+		if t > uint64(^uint32(0)) {
+			t = uint64(^uint32(0))
+		}
+		if t > uint64(cfg.TimeCost) {
+			cfg.TimeCost = uint32(t)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Harden returns a copy of the Config, whose TimeCost has been increased until
+// a single hash takes at least `minDuration` on the current machine.
+// Unlike Calibrate() all other parameters remain unchanged.
+//
+// ErrTimeTooLarge is returned if `minDuration` can't be reached.
+func (c *Config) Harden(minDuration time.Duration) (Config, error) {
+	cfg := *c
+
+	for {
+		// The faster of two runs is used to avoid settling on a single outlier.
+		d, err := cfg.measure()
+		if err != nil {
+			return Config{}, err
+		}
+		if d >= minDuration {
+			if d, err = cfg.measure(); err != nil {
+				return Config{}, err
+			}
+			if d >= minDuration {
+				return cfg, nil
+			}
+		}
+		if cfg.TimeCost == ^uint32(0) {
+			return Config{}, ErrTimeTooLarge
+		}
+
+		// Extrapolate the required TimeCost, but increase it at least by 1.
+		t := uint64(cfg.TimeCost) + 1
+		if d > 0 {
+			if e := uint64(minDuration) * uint64(cfg.TimeCost) / uint64(d); e > t {
+				t = e
+			}
+		}
+		if t > uint64(^uint32(0)) {
+			t = uint64(^uint32(0))
+		}
+		cfg.TimeCost = uint32(t)
+	}
+}
+
+// CalibrateAndSave works like Calibrate(), but additionally writes
+// the resulting Config as JSON to the file at `path`. See LoadConfig().
+func CalibrateAndSave(path string, target time.Duration, maxMem uint32) (Config, error) {
+	cfg, err := Calibrate(target, maxMem)
+	if err != nil {
+		return Config{}, err
+	}
+
+	b, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadConfig reads a Config stored as JSON from the file at `path`.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// ConfigFromBcryptCost returns a ModeArgon2id Config, which takes approximately
+// as long to compute as a bcrypt hash with the given `cost` (4 to 31), using at
+// most `targetMemory` bytes of memory (0 uses the default memory cost).
+//
+// This is an empirical approximation: the duration of a bcrypt hash is NOT
+// measured, but taken from a fixed reference table for a typical ~3 GHz x86-64
+// core (65ms at cost 10, doubling with each increment). Only the Argon2
+// parameters are calibrated on the current machine to match that duration.
+// On considerably faster or slower hardware the result will thus take
+// less or more time than bcrypt would on that same machine.
+func ConfigFromBcryptCost(cost int, targetMemory uint64) (Config, error) {
+	if cost < 4 || cost > 31 {
+		return Config{}, ErrIncorrectParameter
+	}
+
+	target := bcryptReferenceCost10
+	if cost >= 10 {
+		target <<= uint(cost - 10)
+	} else {
+		target >>= uint(10 - cost)
+	}
+
+	maxMem := targetMemory / 1024
+	if maxMem > uint64(MaxMemory) {
+		maxMem = uint64(MaxMemory)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Mode = ModeArgon2id
+	cfg.TimeCost = 1
+	return calibrate(cfg, target, uint32(maxMem))
+}
+
+// ConfigForLatencySLO returns a Config using the given `mode`, for which a
+// single hash stays within the latency objective `p99` on the current machine,
+// using at most `maxMemory` bytes of memory (0 uses the default memory cost).
+//
+// It assumes that each request computes a single hash. To leave headroom for
+// other work and variance the parameters are calibrated for 3/4 of `p99`.
+// Like Calibrate() memory is maximized first and the TimeCost afterwards.
+func ConfigForLatencySLO(p99 time.Duration, maxMemory uint64, mode Mode) (Config, error) {
+	if p99 <= 0 {
+		return Config{}, ErrIncorrectParameter
+	}
+
+	maxMem := maxMemory / 1024
+	if maxMem > uint64(MaxMemory) {
+		maxMem = uint64(MaxMemory)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Mode = mode
+	cfg.TimeCost = 1
+	return calibrate(cfg, p99/4*3, uint32(maxMem))
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// ConfigFromTOML parses the `[argon2]` table of the TOML document `data`.
+//
+// Only the keys below are understood and other tables are ignored.
+// Missing keys retain their DefaultConfig() value.
+//
+//	[argon2]
+//	mode = "argon2id"     # "argon2d", "argon2i" or "argon2id"
+//	version = "13"        # "10" or "13"
+//	hash_length = 32
+//	salt_length = 16
+//	time_cost = 3
+//	memory_cost = 65536   # in KiB
+//	parallelism = 4
+//
+// This is not a complete TOML parser: Values must be
+// integers or basic strings on a single line each.
+func ConfigFromTOML(data []byte) (Config, error) {
+	cfg := DefaultConfig()
+	inTable := false
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(stripTOMLComment(s.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			inTable = line == "[argon2]"
+			continue
+		}
+		if !inTable {
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return Config{}, ErrInvalidTOML
+		}
+
+		key := strings.TrimSpace(line[:i])
+		val := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "mode", "version":
+			str, err := strconv.Unquote(val)
+			if err != nil {
+				return Config{}, ErrInvalidTOML
+			}
+
+			if key == "mode" {
+				cfg.Mode, err = modeFromName(str)
+			} else {
+				cfg.Version, err = versionFromName(str)
+			}
+			if err != nil {
+				return Config{}, err
+			}
+		default:
+			var dst *uint32
+
+			switch key {
+			case "hash_length":
+				dst = &cfg.HashLength
+			case "salt_length":
+				dst = &cfg.SaltLength
+			case "time_cost":
+				dst = &cfg.TimeCost
+			case "memory_cost":
+				dst = &cfg.MemoryCost
+			case "parallelism":
+				dst = &cfg.Parallelism
+			default:
+				continue
+			}
+
+			n, err := strconv.ParseUint(strings.ReplaceAll(val, "_", ""), 10, 32)
+			if err != nil {
+				return Config{}, ErrInvalidTOML
+			}
+			*dst = uint32(n)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// stripTOMLComment removes a trailing "# ..." comment outside of a string.
+func stripTOMLComment(line string) string {
+	quoted := false
+
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+
+	return line
+}
+
+func modeFromName(name string) (Mode, error) {
+	for _, m := range SupportedModes() {
+		if strings.EqualFold(name, m.String()) {
+			return m, nil
+		}
+	}
+	return 0, ErrIncorrectType
+}
+
+func versionFromName(name string) (Version, error) {
+	for _, v := range SupportedVersions() {
+		if name == v.String() {
+			return v, nil
+		}
+	}
+	return 0, ErrIncorrectParameter
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build argon2_debug
+
+package argon2
+
+import "sync"
+
+// A registry of memory ranges currently being wiped by SecureZeroMemory.
+// Only compiled in with the "argon2_debug" build tag.
+var (
+	wipeMu     sync.Mutex
+	wipeRanges = map[uintptr]uintptr{}
+)
+
+// Registers [p, p+n) as being wiped and panics
+// if it overlaps with a concurrently wiped range.
+func wipeBegin(p uintptr, n int) {
+	end := p + uintptr(n)
+
+	wipeMu.Lock()
+	defer wipeMu.Unlock()
+
+	for start, stop := range wipeRanges {
+		if p < stop && start < end {
+			panic("argon2: concurrent SecureZeroMemory of overlapping memory")
+		}
+	}
+
+	wipeRanges[p] = end
+}
+
+// Unregisters a range previously registered with wipeBegin.
+func wipeEnd(p uintptr) {
+	wipeMu.Lock()
+	delete(wipeRanges, p)
+	wipeMu.Unlock()
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build argon2_debug
+
+package argon2
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestSecureZeroMemoryOverlap(t *testing.T) {
+	buf := make([]byte, 64)
+	p := uintptr(unsafe.Pointer(&buf[0]))
+
+	// Simulate a concurrent wipe of the first half of buf.
+	wipeBegin(p, 32)
+	defer wipeEnd(p)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("overlapping wipes must panic")
+		}
+	}()
+
+	SecureZeroMemory(buf[16:])
+}
+
+func TestSecureZeroMemoryDisjoint(t *testing.T) {
+	buf := make([]byte, 64)
+	p := uintptr(unsafe.Pointer(&buf[0]))
+
+	wipeBegin(p, 32)
+	defer wipeEnd(p)
+
+	SecureZeroMemory(buf[32:])
+}
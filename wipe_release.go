@@ -0,0 +1,11 @@
+// Copyright (c) 2016 Leonard Hecker
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !argon2_debug
+
+package argon2
+
+// See wipe_debug.go. These are no-ops in regular builds.
+func wipeBegin(p uintptr, n int) {}
+func wipeEnd(p uintptr)          {}